@@ -0,0 +1,37 @@
+// Package handlers reads as of an earlier time.
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errBadAsOf = errors.New("bad as_of")
+
+// asOfFrom reads the as_of query parameter, either an RFC 3339 time, unix
+// milliseconds or now, returning it in unix nanoseconds and whether it was
+// set.
+func asOfFrom(req *http.Request) (int64, bool, error) {
+	value := strings.TrimSpace(req.URL.Query().Get("as_of"))
+	if value == "" {
+		return 0, false, nil
+	}
+
+	if value == "now" {
+		return time.Now().UnixNano(), true, nil
+	}
+
+	if millis, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return millis * int64(time.Millisecond), true, nil
+	}
+
+	at, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return 0, false, errBadAsOf
+	}
+
+	return at.UnixNano(), true, nil
+}
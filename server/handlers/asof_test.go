@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAsOfFrom(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		at     int64
+		set    bool
+		now    bool
+		bad    bool
+	}{
+		{name: "Not set", target: "/list/"},
+		{name: "Millis", target: "/list/?as_of=1500", at: 1500 * int64(time.Millisecond), set: true},
+		{name: "RFC 3339", target: "/list/?as_of=1970-01-01T00:00:02Z", at: 2 * int64(time.Second), set: true},
+		{name: "Now", target: "/list/?as_of=now", set: true, now: true},
+		{name: "Bogus", target: "/list/?as_of=yesterday", bad: true},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			before := time.Now().UnixNano()
+
+			at, set, err := asOfFrom(httptest.NewRequest("GET", test.target, nil))
+			if (err != nil) != test.bad {
+				t.Fatalf("Expected error %v but got %v", test.bad, err)
+			}
+
+			if test.now {
+				if at < before || at > time.Now().UnixNano() || !set {
+					t.Errorf("Expected now set but got %d set %v", at, set)
+				}
+
+				return
+			}
+
+			if at != test.at || set != test.set {
+				t.Errorf("Expected %d set %v but got %d set %v", test.at, test.set, at, set)
+			}
+		})
+	}
+}
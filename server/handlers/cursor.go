@@ -0,0 +1,77 @@
+// Package handlers reads ranges of keys to list.
+package handlers
+
+import (
+	store "KeyValueStoreServer/server/store"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var errBadRange = errors.New("bad range")
+
+// rangeFrom reads the prefix, start, end, limit and cursor query parameters
+// into the range of keys to list, and whether any were set. The cursor is
+// the one returned with the previous page, see formatCursor, the time in unix
+// nanoseconds that page was listed as of also being returned, zero if it was
+// listed live.
+func rangeFrom(req *http.Request) (store.KeyRange, int64, bool, error) {
+	query := req.URL.Query()
+
+	r := store.KeyRange{
+		Prefix: query.Get("prefix"),
+		Start:  query.Get("start"),
+		End:    query.Get("end"),
+	}
+
+	set := r.Prefix != "" || r.Start != "" || r.End != ""
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return store.KeyRange{}, 0, false, errBadRange
+		}
+
+		r.Limit = n
+		set = true
+	}
+
+	var at int64
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil {
+			return store.KeyRange{}, 0, false, errBadRange
+		}
+
+		listed, after, found := strings.Cut(string(decoded), ".")
+		if !found || after == "" {
+			return store.KeyRange{}, 0, false, errBadRange
+		}
+
+		if listed != "" {
+			if at, err = strconv.ParseInt(listed, 10, 64); err != nil || at <= 0 {
+				return store.KeyRange{}, 0, false, errBadRange
+			}
+		}
+
+		r.After = after
+		set = true
+	}
+
+	return r, at, set, nil
+}
+
+// formatCursor turns the last key of a page into an opaque cursor for the
+// next, along with the time in unix nanoseconds the page was listed as of so
+// the next carries on through the same point, zero if it was listed live.
+func formatCursor(next string, at int64) string {
+	listed := ""
+	if at != 0 {
+		listed = strconv.FormatInt(at, 10)
+	}
+
+	return base64.RawURLEncoding.EncodeToString([]byte(listed + "." + next))
+}
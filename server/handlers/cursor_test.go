@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	store "KeyValueStoreServer/server/store"
+	"encoding/base64"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRangeFrom(t *testing.T) {
+	encode := base64.RawURLEncoding.EncodeToString
+
+	tests := []struct {
+		name   string
+		target string
+		r      store.KeyRange
+		at     int64
+		set    bool
+		bad    bool
+	}{
+		{name: "Not set", target: "/list/"},
+		{name: "Prefix", target: "/list/?prefix=app", r: store.KeyRange{Prefix: "app"}, set: true},
+		{
+			name:   "Range",
+			target: "/list/?start=a&end=b&limit=10",
+			r:      store.KeyRange{Start: "a", End: "b", Limit: 10},
+			set:    true,
+		},
+		{
+			name:   "Cursor",
+			target: "/list/?cursor=" + formatCursor("key/1", 0),
+			r:      store.KeyRange{After: "key/1"},
+			set:    true,
+		},
+		{
+			name:   "Cursor as of",
+			target: "/list/?cursor=" + formatCursor("key.1", 1500),
+			r:      store.KeyRange{After: "key.1"},
+			at:     1500,
+			set:    true,
+		},
+		{name: "Bad limit", target: "/list/?limit=0", bad: true},
+		{name: "Bad cursor", target: "/list/?cursor=***", bad: true},
+		{name: "Bare key cursor", target: "/list/?cursor=" + encode([]byte("key")), bad: true},
+		{name: "Bad cursor time", target: "/list/?cursor=" + encode([]byte("x.key")), bad: true},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			r, at, set, err := rangeFrom(httptest.NewRequest("GET", test.target, nil))
+			if (err != nil) != test.bad {
+				t.Fatalf("Expected error %v but got %v", test.bad, err)
+			}
+
+			if r != test.r || at != test.at || set != test.set {
+				t.Errorf("Expected %v, %d, %v but got %v, %d, %v", test.r, test.at, test.set, r, at, set)
+			}
+		})
+	}
+}
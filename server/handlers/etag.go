@@ -0,0 +1,55 @@
+// Package handlers entity tags for versioned keys.
+package handlers
+
+import (
+	store "KeyValueStoreServer/server/store"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// formatETag turns a key version into a strong entity tag.
+func formatETag(version uint64) string {
+	return fmt.Sprintf("%q", strconv.FormatUint(version, 10))
+}
+
+// parseETags reads an If-Match or If-None-Match header into the versions it
+// lists, nil if the header is not set. Tags that are not versions are ignored
+// so can never match.
+func parseETags(header string) *store.VersionMatch {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return nil
+	}
+
+	if header == "*" {
+		return &store.VersionMatch{Any: true}
+	}
+
+	match := &store.VersionMatch{}
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+
+		unquoted, err := strconv.Unquote(tag)
+		if err != nil {
+			continue
+		}
+
+		if version, err := strconv.ParseUint(unquoted, 10, 64); err == nil {
+			match.Versions = append(match.Versions, version)
+		}
+	}
+
+	return match
+}
+
+// preconditionFrom builds a store precondition from the conditional headers
+// on a request.
+func preconditionFrom(req *http.Request) store.Precondition {
+	return store.Precondition{
+		IfMatch:     parseETags(req.Header.Get("If-Match")),
+		IfNoneMatch: parseETags(req.Header.Get("If-None-Match")),
+	}
+}
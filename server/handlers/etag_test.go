@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"testing"
+)
+
+func TestParseETags(t *testing.T) {
+	t.Run("Not set", func(t *testing.T) {
+		if match := parseETags(""); match != nil {
+			t.Errorf("Expected nil for a missing header but got %v", match)
+		}
+	})
+	t.Run("Any", func(t *testing.T) {
+		if match := parseETags("*"); match == nil || !match.Any {
+			t.Errorf("Expected * to match any version but got %v", match)
+		}
+	})
+	t.Run("List", func(t *testing.T) {
+		match := parseETags(`"3", W/"5", "bogus", 7`)
+		if match == nil || len(match.Versions) != 2 || !match.Matches(3) || !match.Matches(5) || match.Matches(7) {
+			t.Errorf("Expected versions 3 and 5 but got %v", match)
+		}
+	})
+	t.Run("Round trip", func(t *testing.T) {
+		if match := parseETags(formatETag(42)); match == nil || !match.Matches(42) {
+			t.Errorf("Expected formatted tag to parse back but got %v", match)
+		}
+	})
+}
@@ -0,0 +1,50 @@
+// Package handlers reads how to filter and sort lists.
+package handlers
+
+import (
+	store "KeyValueStoreServer/server/store"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+var errBadQuery = errors.New("bad query")
+
+// listQueryFrom reads the sort, order, owner, min_reads and older_than query
+// parameters into how a list is filtered and sorted, and whether any were
+// set. Sort is one of key, reads, writes or age and order asc or desc,
+// ascending by default. Older_than is whole seconds or a duration such as
+// 90s or 1h.
+func listQueryFrom(req *http.Request) (store.ListQuery, bool, error) {
+	query := req.URL.Query()
+
+	sortBy, err := store.ParseListSort(query.Get("sort"))
+	if err != nil {
+		return store.ListQuery{}, false, errBadQuery
+	}
+
+	q := store.ListQuery{Owner: query.Get("owner"), Sort: sortBy}
+
+	switch query.Get("order") {
+	case "", "asc":
+	case "desc":
+		q.Descending = true
+	default:
+		return store.ListQuery{}, false, errBadQuery
+	}
+
+	if minReads := query.Get("min_reads"); minReads != "" {
+		if q.MinReads, err = strconv.Atoi(minReads); err != nil || q.MinReads < 0 {
+			return store.ListQuery{}, false, errBadQuery
+		}
+	}
+
+	if olderThan := query.Get("older_than"); olderThan != "" {
+		var ok bool
+		if q.OlderThan, ok = parseDuration(olderThan); !ok {
+			return store.ListQuery{}, false, errBadQuery
+		}
+	}
+
+	return q, q != (store.ListQuery{}), nil
+}
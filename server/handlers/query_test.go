@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	store "KeyValueStoreServer/server/store"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestListQueryFrom(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		query  store.ListQuery
+		set    bool
+		bad    bool
+	}{
+		{name: "Not set", target: "/list/"},
+		{
+			name:   "Hottest",
+			target: "/list/?sort=reads&order=desc",
+			query:  store.ListQuery{Sort: store.SortReads, Descending: true},
+			set:    true,
+		},
+		{name: "Owner", target: "/list/?owner=user_b", query: store.ListQuery{Owner: "user_b"}, set: true},
+		{
+			name:   "Filters",
+			target: "/list/?min_reads=3&older_than=90",
+			query:  store.ListQuery{MinReads: 3, OlderThan: 90 * time.Second},
+			set:    true,
+		},
+		{name: "Duration", target: "/list/?older_than=1h", query: store.ListQuery{OlderThan: time.Hour}, set: true},
+		{name: "Bad sort", target: "/list/?sort=size", bad: true},
+		{name: "Bad order", target: "/list/?order=up", bad: true},
+		{name: "Bad min reads", target: "/list/?min_reads=-1", bad: true},
+		{name: "Bad older than", target: "/list/?older_than=soon", bad: true},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			query, set, err := listQueryFrom(httptest.NewRequest("GET", test.target, nil))
+			if (err != nil) != test.bad {
+				t.Fatalf("Expected error %v but got %v", test.bad, err)
+			}
+
+			if query != test.query || set != test.set {
+				t.Errorf("Expected %v, %v but got %v, %v", test.query, test.set, query, set)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+// Package handlers serve access control lists.
+package handlers
+
+import (
+	log "KeyValueStoreServer/server/loggers"
+	store "KeyValueStoreServer/server/store"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// ACLURLPath /acl.
+const ACLURLPath = "/acl"
+
+// ServeACL grants a user rights over a key on PUT to /acl/{key}/{user} with a
+// JSON body of read, write and delete, and revokes them all on DELETE. Only
+// the owner of the key or admin may. The grants are shown in /list/{key}.
+func (h *Handler) ServeACL(writer http.ResponseWriter, req *http.Request) {
+	log.RequestChannel <- req
+
+	key, grantee := grantPath(req.URL.Path)
+	if key == "" || grantee == "" {
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	username := getUsername(req)
+
+	if username == "" {
+		writer.WriteHeader(http.StatusUnauthorized)
+		_, _ = writer.Write([]byte("Not Authorised"))
+
+		return
+	}
+
+	var grant store.Grant
+
+	switch req.Method {
+	case http.MethodPut:
+		if err := json.NewDecoder(req.Body).Decode(&grant); err != nil {
+			writer.WriteHeader(http.StatusBadRequest)
+			_, _ = writer.Write([]byte("Bad Request"))
+
+			return
+		}
+	case http.MethodDelete:
+	default:
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	response := <-h.store.GrantAccess(key, username, grantee, grant)
+	if err, ok := response.(error); ok {
+		writeError(writer, err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusOK)
+	_, _ = writer.Write([]byte("OK"))
+}
+
+// grantPath splits /acl/{key}/{user} into the key and user, both empty if the
+// path is not of that form.
+func grantPath(urlPath string) (string, string) {
+	path, ok := strings.CutPrefix(urlPath, ACLURLPath+"/")
+	if !ok {
+		return "", ""
+	}
+
+	elements := strings.Split(path, "/")
+	if len(elements) != 2 {
+		return "", ""
+	}
+
+	return elements[0], elements[1]
+}
@@ -0,0 +1,94 @@
+// Package handlers serve the feed of changes to the store.
+package handlers
+
+import (
+	log "KeyValueStoreServer/server/loggers"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// ChangesURLPath /changes.
+const ChangesURLPath = "/changes"
+
+// defaultChangesLimit how many changes are returned if no limit is given.
+const defaultChangesLimit = 100
+
+var errBadChanges = errors.New("bad changes")
+
+// ServeChanges pages through the recent changes to the store after a
+// sequence number, see changesFrom, oldest first. Each gives the key, what
+// happened to it, its owner and version and when it was committed. Next is
+// the sequence number to ask after for the next page. If the changes asked
+// for are no longer kept it returns 410 and the caller must list the store
+// again. Admin sees every change, anyone else only those to keys they may
+// read.
+func (h *Handler) ServeChanges(writer http.ResponseWriter, req *http.Request) {
+	log.RequestChannel <- req
+
+	if req.Method != http.MethodGet {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	username := getUsername(req)
+
+	if username == "" {
+		writer.WriteHeader(http.StatusUnauthorized)
+		_, _ = writer.Write([]byte("Not Authorised"))
+
+		return
+	}
+
+	since, limit, err := changesFrom(req)
+	if err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		_, _ = writer.Write([]byte("Bad Changes"))
+
+		return
+	}
+
+	page, err := h.store.Changes(username, since, limit)
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+
+	data, err := json.Marshal(page)
+	if err != nil {
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusOK)
+	_, _ = writer.Write(data)
+}
+
+// changesFrom reads the since and limit query parameters, the sequence
+// number to return the changes after, zero if not set, and how many to
+// return, defaultChangesLimit if not set.
+func changesFrom(req *http.Request) (uint64, int, error) {
+	query := req.URL.Query()
+
+	var since uint64
+
+	if value := query.Get("since"); value != "" {
+		var err error
+		if since, err = strconv.ParseUint(value, 10, 64); err != nil {
+			return 0, 0, errBadChanges
+		}
+	}
+
+	limit := defaultChangesLimit
+
+	if value := query.Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 {
+			return 0, 0, errBadChanges
+		}
+	}
+
+	return since, limit, nil
+}
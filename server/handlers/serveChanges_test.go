@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestChangesFrom(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		since  uint64
+		limit  int
+		bad    bool
+	}{
+		{name: "Not set", target: "/changes", limit: defaultChangesLimit},
+		{name: "Since", target: "/changes?since=42", since: 42, limit: defaultChangesLimit},
+		{name: "Limit", target: "/changes?since=42&limit=10", since: 42, limit: 10},
+		{name: "Bad since", target: "/changes?since=-1", bad: true},
+		{name: "Bad limit", target: "/changes?limit=0", bad: true},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			since, limit, err := changesFrom(httptest.NewRequest("GET", test.target, nil))
+			if (err != nil) != test.bad {
+				t.Fatalf("Expected error %v but got %v", test.bad, err)
+			}
+
+			if since != test.since || limit != test.limit {
+				t.Errorf("Expected %d, %d but got %d, %d", test.since, test.limit, since, limit)
+			}
+		})
+	}
+}
@@ -15,6 +15,16 @@ import (
 // Admin = admin.
 const Admin = "admin"
 
+// Handler serves the endpoints that need access to a store.
+type Handler struct {
+	store *store.Store
+}
+
+// New creates a handler serving requests from the given store.
+func New(s *store.Store) *Handler {
+	return &Handler{store: s}
+}
+
 type claims struct {
 	Username string `json:"username"`
 	jwt.StandardClaims
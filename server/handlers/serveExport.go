@@ -0,0 +1,191 @@
+// Package handlers serve exporting and importing the store.
+package handlers
+
+import (
+	log "KeyValueStoreServer/server/loggers"
+	store "KeyValueStoreServer/server/store"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// ExportURLPath /admin/export.
+const ExportURLPath = "/admin/export"
+
+// ImportURLPath /admin/import.
+const ImportURLPath = "/admin/import"
+
+var errBadImportOptions = errors.New("bad import options")
+
+// importLineError why a line of an import failed, lines counting from 1.
+type importLineError struct {
+	Line  int    `json:"line"`
+	Key   string `json:"key,omitempty"`
+	Error string `json:"error"`
+}
+
+// importResult how many lines of an import were stored or skipped and why
+// any failed.
+type importResult struct {
+	Imported int               `json:"imported"`
+	Skipped  int               `json:"skipped"`
+	Errors   []importLineError `json:"errors"`
+}
+
+// ServeExport streams every entry in the store on GET as JSON Lines, one
+// store.ExportEntry per line. Only admin may.
+func (h *Handler) ServeExport(writer http.ResponseWriter, req *http.Request) {
+	log.RequestChannel <- req
+
+	if req.Method != http.MethodGet {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	username := getUsername(req)
+
+	if username == "" {
+		writer.WriteHeader(http.StatusUnauthorized)
+		_, _ = writer.Write([]byte("Not Authorised"))
+
+		return
+	}
+
+	if username != Admin {
+		writeError(writer, store.ErrForbidden)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/x-ndjson")
+	writer.WriteHeader(http.StatusOK)
+
+	encoder := json.NewEncoder(writer)
+
+	// once streaming has started a failure can only cut the export short
+	err := h.store.Export(username, func(entry store.ExportEntry) error {
+		return encoder.Encode(entry)
+	})
+	if err != nil {
+		log.WarnChannel <- fmt.Sprintf("Export stopped early %v", err)
+	}
+}
+
+// ServeImport loads JSON Lines as written by ServeExport on POST, as in
+// importOptionsFrom, and reports how many lines were imported or skipped
+// and why any failed. A failed line does not stop the rest. Only admin may.
+func (h *Handler) ServeImport(writer http.ResponseWriter, req *http.Request) {
+	log.RequestChannel <- req
+
+	if req.Method != http.MethodPost {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	username := getUsername(req)
+
+	if username == "" {
+		writer.WriteHeader(http.StatusUnauthorized)
+		_, _ = writer.Write([]byte("Not Authorised"))
+
+		return
+	}
+
+	if username != Admin {
+		writeError(writer, store.ErrForbidden)
+		return
+	}
+
+	opts, err := importOptionsFrom(req)
+	if err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		_, _ = writer.Write([]byte("Bad Import Options"))
+
+		return
+	}
+
+	result, err := h.importLines(req.Body, username, opts)
+	if err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusOK)
+	_, _ = writer.Write(data)
+}
+
+// importLines imports each line of body, skipping blank lines. The error is
+// only set if body could not be read.
+func (h *Handler) importLines(body io.Reader, username string, opts store.ImportOptions) (importResult, error) {
+	result := importResult{Errors: []importLineError{}}
+	reader := bufio.NewReader(body)
+
+	for number := 1; ; number++ {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return result, err
+		}
+
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var entry store.ExportEntry
+
+			stored, importErr := false, json.Unmarshal(line, &entry)
+			if importErr == nil {
+				stored, importErr = h.store.Import(username, entry, opts)
+			}
+
+			switch {
+			case importErr != nil:
+				result.Errors = append(result.Errors,
+					importLineError{Line: number, Key: entry.Key, Error: importErr.Error()})
+			case stored:
+				result.Imported++
+			default:
+				result.Skipped++
+			}
+		}
+
+		if err != nil {
+			return result, nil
+		}
+	}
+}
+
+// importOptionsFrom reads the overwrite, skip_existing and preserve_owner
+// query parameters, each true or false, false if not set.
+func importOptionsFrom(req *http.Request) (store.ImportOptions, error) {
+	query := req.URL.Query()
+
+	var opts store.ImportOptions
+
+	for name, option := range map[string]*bool{
+		"overwrite":      &opts.Overwrite,
+		"skip_existing":  &opts.SkipExisting,
+		"preserve_owner": &opts.PreserveOwner,
+	} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+
+		set, err := strconv.ParseBool(value)
+		if err != nil {
+			return store.ImportOptions{}, errBadImportOptions
+		}
+
+		*option = set
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	store "KeyValueStoreServer/server/store"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestImportOptionsFrom(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		opts   store.ImportOptions
+		bad    bool
+	}{
+		{name: "Not set", target: "/admin/import"},
+		{
+			name:   "Overwrite",
+			target: "/admin/import?overwrite=true&preserve_owner=1",
+			opts:   store.ImportOptions{Overwrite: true, PreserveOwner: true},
+		},
+		{
+			name:   "Skip existing",
+			target: "/admin/import?skip_existing=true&overwrite=false",
+			opts:   store.ImportOptions{SkipExisting: true},
+		},
+		{name: "Bogus", target: "/admin/import?overwrite=maybe", bad: true},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			opts, err := importOptionsFrom(httptest.NewRequest("POST", test.target, nil))
+			if (err != nil) != test.bad {
+				t.Fatalf("Expected error %v but got %v", test.bad, err)
+			}
+
+			if opts != test.opts {
+				t.Errorf("Expected %v but got %v", test.opts, opts)
+			}
+		})
+	}
+}
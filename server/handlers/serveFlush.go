@@ -0,0 +1,82 @@
+// Package handlers serve deleting many keys at once.
+package handlers
+
+import (
+	log "KeyValueStoreServer/server/loggers"
+	"encoding/json"
+	"net/http"
+)
+
+// FlushURLPath /admin/flush.
+const FlushURLPath = "/admin/flush"
+
+// OwnedURLPath /owned.
+const OwnedURLPath = "/owned"
+
+// removed reports how many keys were deleted.
+type removed struct {
+	Removed int `json:"removed"`
+}
+
+// ServeFlush deletes every key on POST, or just those starting with the
+// prefix query parameter, all at once. Only admin may.
+func (h *Handler) ServeFlush(writer http.ResponseWriter, req *http.Request) {
+	log.RequestChannel <- req
+
+	if req.Method != http.MethodPost {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	username := getUsername(req)
+
+	if username == "" {
+		writer.WriteHeader(http.StatusUnauthorized)
+		_, _ = writer.Write([]byte("Not Authorised"))
+
+		return
+	}
+
+	count, err := h.store.Flush(username, req.URL.Query().Get("prefix"))
+	writeRemoved(writer, count, err)
+}
+
+// ServeOwned deletes every key the caller owns on DELETE, all at once.
+func (h *Handler) ServeOwned(writer http.ResponseWriter, req *http.Request) {
+	log.RequestChannel <- req
+
+	if req.Method != http.MethodDelete {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	username := getUsername(req)
+
+	if username == "" {
+		writer.WriteHeader(http.StatusUnauthorized)
+		_, _ = writer.Write([]byte("Not Authorised"))
+
+		return
+	}
+
+	count, err := h.store.DeleteOwned(username)
+	writeRemoved(writer, count, err)
+}
+
+// writeRemoved writes how many keys were deleted, or why they could not be.
+func writeRemoved(writer http.ResponseWriter, count int, err error) {
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+
+	data, err := json.Marshal(removed{Removed: count})
+	if err != nil {
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusOK)
+	_, _ = writer.Write(data)
+}
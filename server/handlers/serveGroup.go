@@ -0,0 +1,87 @@
+// Package handlers serve groups of users.
+package handlers
+
+import (
+	log "KeyValueStoreServer/server/loggers"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// GroupURLPath /group.
+const GroupURLPath = "/group"
+
+// ServeGroup returns the groups the caller belongs to on GET to /group/, all
+// of them for admin. Admin sets the members of a group with PUT to
+// /group/{name} and a JSON list of users, or removes it with DELETE.
+func (h *Handler) ServeGroup(writer http.ResponseWriter, req *http.Request) {
+	log.RequestChannel <- req
+
+	username := getUsername(req)
+
+	if username == "" {
+		writer.WriteHeader(http.StatusUnauthorized)
+		_, _ = writer.Write([]byte("Not Authorised"))
+
+		return
+	}
+
+	if req.URL.Path == GroupURLPath+"/" {
+		if req.Method != http.MethodGet {
+			writer.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		data, err := json.Marshal(h.store.Groups(username))
+		if err != nil {
+			writer.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(http.StatusOK)
+		_, _ = writer.Write(data)
+
+		return
+	}
+
+	name := GetKeyValue(GroupURLPath+"/", req.URL.Path)
+	if name == "" {
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var members []string
+
+	switch req.Method {
+	case http.MethodPut:
+		if err := json.NewDecoder(req.Body).Decode(&members); err != nil || len(members) == 0 {
+			writer.WriteHeader(http.StatusBadRequest)
+			_, _ = writer.Write([]byte("Bad Request"))
+
+			return
+		}
+	case http.MethodDelete:
+	default:
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := h.store.SetGroup(username, name, members); err != nil {
+		writeError(writer, err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusOK)
+	_, _ = writer.Write([]byte("OK"))
+}
+
+// groupFrom reads the group a put creates its key for from the X-Group header
+// or the group query parameter, empty if the caller is to own it.
+func groupFrom(req *http.Request) string {
+	if group := strings.TrimSpace(req.Header.Get("X-Group")); group != "" {
+		return group
+	}
+
+	return strings.TrimSpace(req.URL.Query().Get("group"))
+}
@@ -0,0 +1,108 @@
+// Package handlers serve the history of keys.
+package handlers
+
+import (
+	log "KeyValueStoreServer/server/loggers"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// HistoryURLPath /history.
+const HistoryURLPath = "/history"
+
+var errBadVersion = errors.New("bad version")
+
+var errBadHistory = errors.New("bad history")
+
+// ServeHistory lists the versions kept of a key on GET, with who wrote each
+// and when, for anyone who may read the key. POST with a version query
+// parameter makes that version current again, only the owner or admin may.
+func (h *Handler) ServeHistory(writer http.ResponseWriter, req *http.Request) {
+	log.RequestChannel <- req
+
+	key := GetKeyValue(HistoryURLPath+"/", req.URL.Path)
+	if key == "" {
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	username := getUsername(req)
+
+	if username == "" {
+		writer.WriteHeader(http.StatusUnauthorized)
+		_, _ = writer.Write([]byte("Not Authorised"))
+
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		response := <-h.store.History(key, username)
+		if err, ok := response.(error); ok {
+			writeError(writer, err)
+			return
+		}
+
+		data, err := json.Marshal(response)
+		if err != nil {
+			writer.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(http.StatusOK)
+		_, _ = writer.Write(data)
+
+	case http.MethodPost:
+		version, err := versionFrom(req)
+		if err != nil || version == 0 {
+			writer.WriteHeader(http.StatusBadRequest)
+			_, _ = writer.Write([]byte("Bad Version"))
+
+			return
+		}
+
+		writeUpserted(writer, <-h.store.Restore(key, username, version))
+
+	default:
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// versionFrom reads the version query parameter, zero if it is not set.
+func versionFrom(req *http.Request) (uint64, error) {
+	value := strings.TrimSpace(req.URL.Query().Get("version"))
+	if value == "" {
+		return 0, nil
+	}
+
+	version, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, errBadVersion
+	}
+
+	return version, nil
+}
+
+// historyLimitFrom reads how many previous versions of a key to keep from the
+// X-History header or the history query parameter, nil if neither is set.
+func historyLimitFrom(req *http.Request) (*int, error) {
+	value := strings.TrimSpace(req.Header.Get("X-History"))
+	if value == "" {
+		value = strings.TrimSpace(req.URL.Query().Get("history"))
+	}
+
+	if value == "" {
+		return nil, nil
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 0 {
+		return nil, errBadHistory
+	}
+
+	return &limit, nil
+}
@@ -5,7 +5,6 @@ import (
 	log "KeyValueStoreServer/server/loggers"
 	store "KeyValueStoreServer/server/store"
 	"errors"
-	"io"
 	"net/http"
 	"strings"
 )
@@ -23,7 +22,7 @@ const StoreKeyValueExistsButNotForOwner = 2
 const StoreKeyValueNotFound = 3
 
 // ServeKey marshalls the request to the appropriate handler based on method.
-func ServeKey(writer http.ResponseWriter, req *http.Request) {
+func (h *Handler) ServeKey(writer http.ResponseWriter, req *http.Request) {
 	log.RequestChannel <- req
 	// we expect a key value on the url
 	// get it here and pass it in to our worker functions
@@ -45,20 +44,24 @@ func ServeKey(writer http.ResponseWriter, req *http.Request) {
 
 	switch req.Method {
 	case http.MethodGet:
-		serveGet(writer, key, username)
+		h.serveGet(writer, req, key, username)
 
 	case http.MethodPut:
-		value, err := io.ReadAll(req.Body)
+		value, err := readValue(writer, req, h.store.MaxValueSize())
+		if errors.Is(err, store.ErrTooLarge) {
+			writeError(writer, err)
+			return
+		}
 
 		if err != nil {
 			writer.WriteHeader(http.StatusBadRequest)
 			return
 		}
 
-		servePut(writer, string(value), key, username)
+		h.servePut(writer, req, value, key, username)
 
 	case http.MethodDelete:
-		serveDelete(writer, key, username)
+		h.serveDelete(writer, req, key, username)
 	}
 }
 
@@ -84,23 +87,55 @@ func GetKeyValue(prefix, urlPath string) string {
 // servePut - allowed to create or update a values in the store
 // for the given key
 // if updating the store entry must have been created by the username in basicauth
-// otherwise return forbidden.
-func servePut(writer http.ResponseWriter, value string, key string, owner string) {
+// or granted them write access, otherwise return forbidden.
+// If-Match and If-None-Match are honoured, If-None-Match: * only creating.
+// A TTL sets when the key expires, see ttlFrom, and a new key is owned by the
+// group named as in groupFrom if there is one. How many previous versions
+// are kept is set as in historyLimitFrom. The Content-Type and
+// Content-Encoding headers are kept with the value.
+func (h *Handler) servePut(writer http.ResponseWriter, req *http.Request, value string, key string, owner string) {
+	ttl, clearTTL, err := ttlFrom(req)
+	if err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		_, _ = writer.Write([]byte("Bad TTL"))
+
+		return
+	}
+
+	historyLimit, err := historyLimitFrom(req)
+	if err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		_, _ = writer.Write([]byte("Bad History"))
+
+		return
+	}
+
 	// Create upsert request message
-	response := <-store.PublicAccess.Upsert(key, owner, value)
-
-	if response != nil {
-		if val, ok := response.(error); ok {
-			switch {
-			case errors.Is(val, store.ErrForbidden):
-				writer.WriteHeader(http.StatusForbidden)
-				_, _ = writer.Write([]byte("Forbidden"))
-			default:
-				writer.WriteHeader(http.StatusInternalServerError)
-			}
+	response := <-h.store.UpsertWith(store.UpsertRequest{
+		Key:             key,
+		Owner:           owner,
+		Group:           groupFrom(req),
+		Value:           value,
+		ContentType:     req.Header.Get("Content-Type"),
+		ContentEncoding: req.Header.Get("Content-Encoding"),
+		Condition:       preconditionFrom(req),
+		TTL:             ttl,
+		ClearTTL:        clearTTL,
+		HistoryLimit:    historyLimit,
+	})
 
-			return
-		}
+	writeUpserted(writer, response)
+}
+
+// writeUpserted writes the response to a change that stores a new value.
+func writeUpserted(writer http.ResponseWriter, response interface{}) {
+	if val, ok := response.(error); ok {
+		writeError(writer, val)
+		return
+	}
+
+	if dataval, ok := response.(store.DataValue); ok {
+		writer.Header().Set("ETag", formatETag(dataval.Version))
 	}
 
 	writer.WriteHeader(http.StatusOK)
@@ -108,48 +143,136 @@ func servePut(writer http.ResponseWriter, value string, key string, owner string
 }
 
 // serveGet - retreives a value for the given key
-// all entries are accessible regardless of who created them
-// if entry for key does not exist returns 404.
-func serveGet(writer http.ResponseWriter, key string, owner string) {
-	fetchResponse := <-store.PublicAccess.Fetch(key)
+// only the owner and users granted read access may see it
+// if entry for key does not exist or cannot be read returns 404.
+// If-None-Match returns 304 if the value is unchanged.
+// A version query parameter returns that version if it is still kept, an
+// as_of query parameter the value at that time, see asOfFrom.
+// The Content-Type and Content-Encoding the value was stored with are
+// returned with it, and a Range header reads part of it, see writeValue.
+func (h *Handler) serveGet(writer http.ResponseWriter, req *http.Request, key string, owner string) {
+	version, err := versionFrom(req)
+	if err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		_, _ = writer.Write([]byte("Bad Version"))
+
+		return
+	}
+
+	at, asOf, err := asOfFrom(req)
+	if err != nil || (asOf && version != 0) {
+		writer.WriteHeader(http.StatusBadRequest)
+		_, _ = writer.Write([]byte("Bad As Of"))
+
+		return
+	}
+
+	var fetchResponse interface{}
+
+	if asOf {
+		value, fetchErr := h.store.FetchAt(key, owner, at)
+		if errors.Is(fetchErr, store.ErrTooOld) {
+			writeError(writer, fetchErr)
+			return
+		}
+
+		if fetchErr == nil {
+			fetchResponse = value
+		}
+	} else {
+		fetchResponse = <-h.store.FetchWith(store.FetchRequest{Key: key, Owner: owner, Version: version})
+	}
 
 	dataval, ok := fetchResponse.(store.DataValue)
-	if !ok || dataval.Owner != owner {
+	if !ok {
 		writer.WriteHeader(http.StatusNotFound)
 		_, _ = writer.Write([]byte("404 key not found"))
 
 		return
 	}
 
-	writer.WriteHeader(http.StatusOK)
-	_, _ = writer.Write([]byte(dataval.Value))
+	writer.Header().Set("ETag", formatETag(dataval.Version))
+
+	if match := parseETags(req.Header.Get("If-None-Match")); match != nil && match.Matches(dataval.Version) {
+		writer.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if dataval.ContentType != "" {
+		writer.Header().Set("Content-Type", dataval.ContentType)
+	}
+
+	if dataval.ContentEncoding != "" {
+		writer.Header().Set("Content-Encoding", dataval.ContentEncoding)
+	}
+
+	writeValue(writer, req, dataval.Value)
 }
 
 // serveDelete - deletes an entry for a given key
-// only allowed if entry created by username
+// only allowed if entry created by username or granted them delete access
 // if entry does not exist return 404
-// if entry exists but belongs to a different username return 403 forbidden.
-func serveDelete(writer http.ResponseWriter, key string, owner string) {
+// if entry exists but username may not delete it return 403 forbidden.
+// If-Match is honoured.
+func (h *Handler) serveDelete(writer http.ResponseWriter, req *http.Request, key string, owner string) {
 	// check key status
-	response := <-store.PublicAccess.Delete(key, owner)
-	if response != nil {
-		if val, ok := response.(error); ok {
-			switch {
-			case errors.Is(val, store.ErrForbidden):
-				writer.WriteHeader(http.StatusForbidden)
-				_, _ = writer.Write([]byte("Forbidden"))
-			case errors.Is(val, store.ErrNotFound):
-				writer.WriteHeader(http.StatusNotFound)
-				_, _ = writer.Write([]byte("404 key not found"))
-
-			default:
-				writer.WriteHeader(http.StatusInternalServerError)
-			}
-		}
-
+	response := <-h.store.DeleteWith(store.DeleteRequest{
+		Key:       key,
+		Owner:     owner,
+		Condition: preconditionFrom(req),
+	})
+	if val, ok := response.(error); ok {
+		writeError(writer, val)
 		return
 	}
 
 	writer.WriteHeader(http.StatusOK)
 	_, _ = writer.Write([]byte("ok"))
 }
+
+// writeError writes the response for an error from the store.
+func writeError(writer http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, store.ErrForbidden):
+		writer.WriteHeader(http.StatusForbidden)
+		_, _ = writer.Write([]byte("Forbidden"))
+	case errors.Is(err, store.ErrNotFound):
+		writer.WriteHeader(http.StatusNotFound)
+		_, _ = writer.Write([]byte("404 key not found"))
+	case errors.Is(err, store.ErrPreconditionFailed):
+		writer.WriteHeader(http.StatusPreconditionFailed)
+		_, _ = writer.Write([]byte("Precondition Failed"))
+	case errors.Is(err, store.ErrQuotaExceeded):
+		writer.WriteHeader(http.StatusForbidden)
+		_, _ = writer.Write([]byte("Quota Exceeded"))
+	case errors.Is(err, store.ErrBadGrant):
+		writer.WriteHeader(http.StatusBadRequest)
+		_, _ = writer.Write([]byte("Bad Grant"))
+	case errors.Is(err, store.ErrResync):
+		writer.WriteHeader(http.StatusGone)
+		_, _ = writer.Write([]byte("Too Old, Resync"))
+	case errors.Is(err, store.ErrTooOld):
+		writer.WriteHeader(http.StatusGone)
+		_, _ = writer.Write([]byte("Too Old"))
+	case errors.Is(err, store.ErrBadGroup):
+		writer.WriteHeader(http.StatusBadRequest)
+		_, _ = writer.Write([]byte("Bad Group"))
+	case errors.Is(err, store.ErrBadTransfer):
+		writer.WriteHeader(http.StatusBadRequest)
+		_, _ = writer.Write([]byte("Bad Transfer"))
+	case errors.Is(err, store.ErrNoOffer):
+		writer.WriteHeader(http.StatusConflict)
+		_, _ = writer.Write([]byte("No Offer"))
+	case errors.Is(err, store.ErrPinLimit):
+		writer.WriteHeader(http.StatusConflict)
+		_, _ = writer.Write([]byte("Too Many Pinned Keys"))
+	case errors.Is(err, store.ErrTooLarge):
+		writer.WriteHeader(http.StatusRequestEntityTooLarge)
+		_, _ = writer.Write([]byte("Payload Too Large"))
+	case errors.Is(err, store.ErrStoreFull):
+		writer.WriteHeader(http.StatusInsufficientStorage)
+		_, _ = writer.Write([]byte("Store Full"))
+	default:
+		writer.WriteHeader(http.StatusInternalServerError)
+	}
+}
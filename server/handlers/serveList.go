@@ -7,12 +7,23 @@ import (
 	"encoding/json"
 	"net/http"
 	"strings"
+	"time"
 )
 
 const elementLimit = 2
 
-// ServeList - returns a list of all keys and owners.
-func ServeList(writer http.ResponseWriter, req *http.Request) {
+// ServeList - returns a list of all keys and owners in order.
+// The keys listed can be narrowed and paged through as in rangeFrom, the
+// cursor for the next page being returned in X-Next-Cursor. The list is a
+// consistent snapshot of the store, read without holding up writes, as it is
+// now or as it was at the time given by the as_of query parameter, see
+// asOfFrom. The time listed as of is returned in X-As-Of, and the cursor
+// carries on through that same point. The counters are those each key had
+// when last written. Filtering and sorting as in listQueryFrom needs the
+// counters as they are now, so those lists and /list/{key} are read live,
+// each shard at its own moment, and cannot be as of a time. Only admin may
+// list the keys of an owner they are not, or do not belong to.
+func (h *Handler) ServeList(writer http.ResponseWriter, req *http.Request) {
 	log.RequestChannel <- req
 
 	// see if we have an additional key value in url
@@ -35,18 +46,72 @@ func ServeList(writer http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	at, asOf, err := asOfFrom(req)
+	if err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		_, _ = writer.Write([]byte("Bad As Of"))
+
+		return
+	}
+
+	r, listed, _, err := rangeFrom(req)
+	if err != nil || (listed != 0 && asOf && listed != at) {
+		writer.WriteHeader(http.StatusBadRequest)
+		_, _ = writer.Write([]byte("Bad Range"))
+
+		return
+	}
+
+	// a cursor carries on through the point its page was listed as of
+	if listed != 0 {
+		at, asOf = listed, true
+	}
+
+	query, queried, err := listQueryFrom(req)
+	if err != nil || (queried && asOf) {
+		writer.WriteHeader(http.StatusBadRequest)
+		_, _ = writer.Write([]byte("Bad Query"))
+
+		return
+	}
+
+	if asOf || (!queried && len(elements) == 1) {
+		key := ""
+		if len(elements) > 1 {
+			key = elements[1]
+		}
+
+		if !asOf {
+			at = time.Now().UnixNano()
+		}
+
+		h.serveListAt(writer, key, username, at, r)
+
+		return
+	}
+
 	var (
 		data  []byte
 		count int
 	)
 
 	if len(elements) == 1 {
-		// get complete list
-		data, count = getList(username)
+		// get the list of keys in range
+		var next string
+
+		data, count, next, err = h.getList(username, r, query)
+		if err != nil {
+			writeError(writer, err)
+			return
+		}
+
+		if next != "" {
+			writer.Header().Set("X-Next-Cursor", formatCursor(next, 0))
+		}
 	} else {
 		// get for specific key
 
-		data, count = getListForKey(elements[1], username)
+		data, count = h.getListForKey(elements[1], username)
 
 		if count == 0 {
 			writer.WriteHeader(http.StatusNotFound)
@@ -66,21 +131,79 @@ func ServeList(writer http.ResponseWriter, req *http.Request) {
 	}
 }
 
-func getList(username string) ([]byte, int) {
-	// get complete list
-	list := <-store.PublicAccess.List(username)
-	jsonData, err := json.Marshal(list)
+// serveListAt lists the keys in r, or just key if set, as they were at a
+// time in unix nanoseconds, returning that time in X-As-Of.
+func (h *Handler) serveListAt(writer http.ResponseWriter, key, username string, at int64, r store.KeyRange) {
+	var list []store.ListValue
+
+	if key != "" {
+		var err error
+
+		list, err = h.store.ListAt(key, username, at)
+		if err != nil {
+			writeError(writer, err)
+			return
+		}
+	} else {
+		page, err := h.store.ScanAt(username, at, r)
+		if err != nil {
+			writeError(writer, err)
+			return
+		}
+
+		list = page.Keys
+
+		if page.Next != "" {
+			writer.Header().Set("X-Next-Cursor", formatCursor(page.Next, at))
+		}
+	}
+
+	writer.Header().Set("X-As-Of", time.Unix(0, at).UTC().Format(time.RFC3339Nano))
+
+	var result interface{} = list
+
+	switch {
+	case key != "" && len(list) == 0:
+		writer.WriteHeader(http.StatusNotFound)
+		_, _ = writer.Write([]byte("404 Key Not Found"))
+
+		return
+	case key != "":
+		result = list[0]
+	case list == nil:
+		result = []store.ListValue{}
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusOK)
+	_, _ = writer.Write(data)
+}
+
+func (h *Handler) getList(username string, r store.KeyRange, query store.ListQuery) ([]byte, int, string, error) {
+	// get the page of the list asked for
+	page := <-h.store.Scan(username, r, query)
+	if page.Err != nil {
+		return nil, 0, "", page.Err
+	}
+
+	jsonData, err := json.Marshal(page.Keys)
 
 	if err == nil {
-		return jsonData, len(list)
+		return jsonData, len(page.Keys), page.Next, nil
 	}
 
-	return nil, 0
+	return nil, 0, "", nil
 }
 
-func getListForKey(username, key string) ([]byte, int) {
+func (h *Handler) getListForKey(username, key string) ([]byte, int) {
 	// get complete list
-	list := <-store.PublicAccess.ListForKey(username, key)
+	list := <-h.store.ListForKey(username, key)
 
 	if len(list) > 0 {
 		jsonData, err := json.Marshal(list[0])
@@ -0,0 +1,52 @@
+// Package handlers serve pinning keys.
+package handlers
+
+import (
+	log "KeyValueStoreServer/server/loggers"
+	"net/http"
+)
+
+// PinURLPath /pin.
+const PinURLPath = "/pin"
+
+// ServePin pins a key on PUT and unpins it on DELETE, only the owner of the
+// key or admin may.
+func (h *Handler) ServePin(writer http.ResponseWriter, req *http.Request) {
+	log.RequestChannel <- req
+
+	key := GetKeyValue(PinURLPath+"/", req.URL.Path)
+	if key == "" {
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	username := getUsername(req)
+
+	if username == "" {
+		writer.WriteHeader(http.StatusUnauthorized)
+		_, _ = writer.Write([]byte("Not Authorised"))
+
+		return
+	}
+
+	var pinned bool
+
+	switch req.Method {
+	case http.MethodPut:
+		pinned = true
+	case http.MethodDelete:
+		pinned = false
+	default:
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	response := <-h.store.Pin(key, username, pinned)
+	if err, ok := response.(error); ok {
+		writeError(writer, err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusOK)
+	_, _ = writer.Write([]byte("OK"))
+}
@@ -0,0 +1,83 @@
+// Package handlers serve per-user quotas.
+package handlers
+
+import (
+	log "KeyValueStoreServer/server/loggers"
+	store "KeyValueStoreServer/server/store"
+	"encoding/json"
+	"net/http"
+)
+
+// QuotaURLPath /quota.
+const QuotaURLPath = "/quota"
+
+// ServeQuota returns a user's usage and quota on GET, /quota/ being the
+// caller's own. Admin may set a user's quota with PUT and a JSON body of keys
+// and bytes, or return them to the default with DELETE.
+func (h *Handler) ServeQuota(writer http.ResponseWriter, req *http.Request) {
+	log.RequestChannel <- req
+
+	username := getUsername(req)
+
+	if username == "" {
+		writer.WriteHeader(http.StatusUnauthorized)
+		_, _ = writer.Write([]byte("Not Authorised"))
+
+		return
+	}
+
+	user := username
+	if req.URL.Path != QuotaURLPath+"/" {
+		if user = GetKeyValue(QuotaURLPath+"/", req.URL.Path); user == "" {
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		usage, err := h.store.Usage(username, user)
+		if err != nil {
+			writeError(writer, err)
+			return
+		}
+
+		data, err := json.Marshal(usage)
+		if err != nil {
+			writer.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(http.StatusOK)
+		_, _ = writer.Write(data)
+
+	case http.MethodPut:
+		var quota store.Quota
+
+		if err := json.NewDecoder(req.Body).Decode(&quota); err != nil || quota.Keys < 0 || quota.Bytes < 0 {
+			writer.WriteHeader(http.StatusBadRequest)
+			_, _ = writer.Write([]byte("Bad Request"))
+
+			return
+		}
+
+		h.setQuota(writer, username, user, &quota)
+
+	case http.MethodDelete:
+		h.setQuota(writer, username, user, nil)
+
+	default:
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) setQuota(writer http.ResponseWriter, username, user string, quota *store.Quota) {
+	if err := h.store.SetQuota(username, user, quota); err != nil {
+		writeError(writer, err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusOK)
+	_, _ = writer.Write([]byte("OK"))
+}
@@ -0,0 +1,123 @@
+// Package handlers serve ownership transfers.
+package handlers
+
+import (
+	log "KeyValueStoreServer/server/loggers"
+	"encoding/json"
+	"net/http"
+)
+
+// TransferURLPath /transfer.
+const TransferURLPath = "/transfer"
+
+// transferBody names who a key is transferred to and, for admin moving every
+// key a user owns, who from.
+type transferBody struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// ServeTransfer moves keys between owners. PUT /transfer/{key} with a JSON
+// body naming to offers the key to that user, DELETE withdraws the offer and
+// POST by the user offered it accepts. Admin's PUT reassigns the key straight
+// away, and a PUT to /transfer/ naming from and to reassigns every key from
+// owns. GET /transfer/ returns the recent transfers the caller was part of.
+func (h *Handler) ServeTransfer(writer http.ResponseWriter, req *http.Request) {
+	log.RequestChannel <- req
+
+	username := getUsername(req)
+
+	if username == "" {
+		writer.WriteHeader(http.StatusUnauthorized)
+		_, _ = writer.Write([]byte("Not Authorised"))
+
+		return
+	}
+
+	if req.URL.Path == TransferURLPath+"/" {
+		h.serveTransfers(writer, req, username)
+		return
+	}
+
+	key := GetKeyValue(TransferURLPath+"/", req.URL.Path)
+	if key == "" {
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var response interface{}
+
+	switch req.Method {
+	case http.MethodPut:
+		var body transferBody
+
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil || body.To == "" {
+			writer.WriteHeader(http.StatusBadRequest)
+			_, _ = writer.Write([]byte("Bad Request"))
+
+			return
+		}
+
+		if username == Admin {
+			response = <-h.store.Reassign(key, username, body.To)
+		} else {
+			response = <-h.store.Offer(key, username, body.To)
+		}
+	case http.MethodDelete:
+		response = <-h.store.Offer(key, username, "")
+	case http.MethodPost:
+		response = <-h.store.Accept(key, username)
+	default:
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err, ok := response.(error); ok {
+		writeError(writer, err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusOK)
+	_, _ = writer.Write([]byte("OK"))
+}
+
+// serveTransfers lists recent transfers on GET and reassigns every key one
+// user owns on PUT.
+func (h *Handler) serveTransfers(writer http.ResponseWriter, req *http.Request, username string) {
+	var result interface{}
+
+	switch req.Method {
+	case http.MethodGet:
+		result = h.store.Transfers(username)
+	case http.MethodPut:
+		var body transferBody
+
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			writer.WriteHeader(http.StatusBadRequest)
+			_, _ = writer.Write([]byte("Bad Request"))
+
+			return
+		}
+
+		count, err := h.store.ReassignAll(username, body.From, body.To)
+		if err != nil {
+			writeError(writer, err)
+			return
+		}
+
+		result = map[string]int{"transferred": count}
+	default:
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusOK)
+	_, _ = writer.Write(data)
+}
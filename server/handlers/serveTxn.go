@@ -0,0 +1,73 @@
+// Package handlers serve multi-key transactions.
+package handlers
+
+import (
+	log "KeyValueStoreServer/server/loggers"
+	store "KeyValueStoreServer/server/store"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// ServeTxn applies a JSON list of conditions and operations atomically,
+// returning per-operation results or the first failure.
+func (h *Handler) ServeTxn(writer http.ResponseWriter, req *http.Request) {
+	log.RequestChannel <- req
+
+	if req.Method != http.MethodPost {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	username := getUsername(req)
+
+	if username == "" {
+		writer.WriteHeader(http.StatusUnauthorized)
+		_, _ = writer.Write([]byte("Not Authorised"))
+
+		return
+	}
+
+	var txn store.TxnRequest
+
+	if err := json.NewDecoder(req.Body).Decode(&txn); err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		_, _ = writer.Write([]byte("Bad Request"))
+
+		return
+	}
+
+	txn.Owner = username
+
+	response := <-h.store.Transaction(txn)
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(txnStatus(response.Err))
+	_, _ = writer.Write(data)
+}
+
+// txnStatus the status code for a transaction that failed with err.
+func txnStatus(err error) int {
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case errors.Is(err, store.ErrConditionFailed):
+		return http.StatusConflict
+	case errors.Is(err, store.ErrForbidden), errors.Is(err, store.ErrQuotaExceeded):
+		return http.StatusForbidden
+	case errors.Is(err, store.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, store.ErrBadTransaction):
+		return http.StatusBadRequest
+	case errors.Is(err, store.ErrTooLarge):
+		return http.StatusRequestEntityTooLarge
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,223 @@
+// Package handlers serve changes to keys as they happen.
+package handlers
+
+import (
+	log "KeyValueStoreServer/server/loggers"
+	store "KeyValueStoreServer/server/store"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WatchURLPath /watch.
+const WatchURLPath = "/watch"
+
+// defaultPollTimeout how long a long-poll waits for a change if no timeout is
+// given.
+const defaultPollTimeout = 30 * time.Second
+
+var (
+	errBadTimeout = errors.New("bad timeout")
+	errBadSince   = errors.New("bad since")
+)
+
+// ServeWatch follows the changes to a key, /watch/{key}, or to every key with
+// the prefix query parameter, /watch?prefix=, that the caller may read. With
+// Accept: text/event-stream the changes are sent as Server-Sent Events until
+// the caller goes away. Otherwise the request long-polls, waiting up to the
+// timeout query parameter, see pollTimeoutFrom, for changes and returning
+// them, or 204 if there were none. A caller carrying on from the last change
+// it saw gives its sequence number, see sinceFrom, and is first sent the
+// changes committed since, or 410 if they are no longer kept and it must
+// resync. A watcher that falls too far behind is disconnected rather than
+// holding up the store.
+func (h *Handler) ServeWatch(writer http.ResponseWriter, req *http.Request) {
+	log.RequestChannel <- req
+
+	if req.Method != http.MethodGet {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	key := GetKeyValue(WatchURLPath+"/", req.URL.Path)
+	prefix := req.URL.Query().Get("prefix")
+
+	if key != "" && prefix != "" {
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	username := getUsername(req)
+
+	if username == "" {
+		writer.WriteHeader(http.StatusUnauthorized)
+		_, _ = writer.Write([]byte("Not Authorised"))
+
+		return
+	}
+
+	since, resume, err := sinceFrom(req)
+	if err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		_, _ = writer.Write([]byte("Bad Since"))
+
+		return
+	}
+
+	timeout, err := pollTimeoutFrom(req)
+	if err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		_, _ = writer.Write([]byte("Bad Timeout"))
+
+		return
+	}
+
+	var watch *store.Watch
+
+	if resume {
+		if watch, err = h.store.WatchFrom(username, key, prefix, since); err != nil {
+			writeError(writer, err)
+			return
+		}
+	} else {
+		watch = h.store.Watch(username, key, prefix)
+	}
+	defer watch.Close()
+
+	if strings.Contains(req.Header.Get("Accept"), "text/event-stream") {
+		h.serveEvents(writer, req, watch)
+		return
+	}
+
+	h.servePoll(writer, req, watch, timeout)
+}
+
+// serveEvents streams changes as Server-Sent Events, each with the change's
+// sequence number as its id, which a reconnecting client sends back as
+// Last-Event-ID, and its type as the event name.
+func (h *Handler) serveEvents(writer http.ResponseWriter, req *http.Request, watch *store.Watch) {
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case event, ok := <-watch.Events:
+			if !ok {
+				return
+			}
+
+			data, err := json.Marshal(event)
+			if err != nil {
+				return
+			}
+
+			_, err = fmt.Fprintf(writer, "id: %d\nevent: %s\ndata: %s\n\n", event.Seq, event.Type, data)
+			if err != nil {
+				return
+			}
+
+			flusher.Flush()
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
+
+// servePoll waits for the next change and returns it along with any others
+// already waiting. The caller polls again with the last change's sequence
+// number as since so none are missed between polls.
+func (h *Handler) servePoll(writer http.ResponseWriter, req *http.Request, watch *store.Watch,
+	timeout time.Duration) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	var events []store.Event
+
+	select {
+	case event, ok := <-watch.Events:
+		if !ok {
+			writer.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		events = append(events, event)
+	case <-timer.C:
+		writer.WriteHeader(http.StatusNoContent)
+		return
+	case <-req.Context().Done():
+		return
+	}
+
+	for waiting := true; waiting; {
+		select {
+		case event, ok := <-watch.Events:
+			if ok {
+				events = append(events, event)
+			}
+
+			waiting = ok
+		default:
+			waiting = false
+		}
+	}
+
+	data, err := json.Marshal(events)
+	if err != nil {
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusOK)
+	_, _ = writer.Write(data)
+}
+
+// sinceFrom reads the sequence number of the last change the caller saw, and
+// whether it gave one, from the Last-Event-ID header a reconnecting event
+// stream sends, or else the since query parameter.
+func sinceFrom(req *http.Request) (uint64, bool, error) {
+	value := strings.TrimSpace(req.Header.Get("Last-Event-ID"))
+	if value == "" {
+		value = strings.TrimSpace(req.URL.Query().Get("since"))
+	}
+
+	if value == "" {
+		return 0, false, nil
+	}
+
+	since, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, false, errBadSince
+	}
+
+	return since, true, nil
+}
+
+// pollTimeoutFrom reads how long a long-poll waits from the timeout query
+// parameter, either whole seconds or a duration such as 90s or 1m,
+// defaultPollTimeout if it is not set.
+func pollTimeoutFrom(req *http.Request) (time.Duration, error) {
+	value := strings.TrimSpace(req.URL.Query().Get("timeout"))
+	if value == "" {
+		return defaultPollTimeout, nil
+	}
+
+	timeout, ok := parseDuration(value)
+	if !ok || timeout == 0 {
+		return 0, errBadTimeout
+	}
+
+	return timeout, nil
+}
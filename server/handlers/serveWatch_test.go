@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSinceFrom(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		header string
+		since  uint64
+		set    bool
+		bad    bool
+	}{
+		{name: "Not set", target: "/watch/key"},
+		{name: "Query", target: "/watch/key?since=42", since: 42, set: true},
+		{name: "Zero", target: "/watch?prefix=app&since=0", set: true},
+		{name: "Last event", target: "/watch/key", header: "17", since: 17, set: true},
+		{name: "Last event first", target: "/watch/key?since=42", header: "17", since: 17, set: true},
+		{name: "Bogus", target: "/watch/key?since=latest", bad: true},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", test.target, nil)
+			if test.header != "" {
+				req.Header.Set("Last-Event-ID", test.header)
+			}
+
+			since, set, err := sinceFrom(req)
+			if (err != nil) != test.bad {
+				t.Fatalf("Expected error %v but got %v", test.bad, err)
+			}
+
+			if since != test.since || set != test.set {
+				t.Errorf("Expected %d set %v but got %d set %v", test.since, test.set, since, set)
+			}
+		})
+	}
+}
+
+func TestPollTimeoutFrom(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		timeout time.Duration
+		bad     bool
+	}{
+		{name: "Not set", target: "/watch/key", timeout: defaultPollTimeout},
+		{name: "Seconds", target: "/watch/key?timeout=5", timeout: 5 * time.Second},
+		{name: "Duration", target: "/watch?prefix=app&timeout=1m", timeout: time.Minute},
+		{name: "Zero", target: "/watch/key?timeout=0", bad: true},
+		{name: "Bogus", target: "/watch/key?timeout=later", bad: true},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			timeout, err := pollTimeoutFrom(httptest.NewRequest("GET", test.target, nil))
+			if (err != nil) != test.bad {
+				t.Fatalf("Expected error %v but got %v", test.bad, err)
+			}
+
+			if timeout != test.timeout {
+				t.Errorf("Expected %v but got %v", test.timeout, timeout)
+			}
+		})
+	}
+}
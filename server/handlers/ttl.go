@@ -0,0 +1,45 @@
+// Package handlers time to live for keys.
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errBadTTL = errors.New("bad ttl")
+
+// ttlFrom reads the time to live for a put from the X-TTL header or the ttl
+// query parameter, either whole seconds or a duration such as 90s or 1h. A
+// TTL of zero clears any expiry the key has, no TTL at all keeps it.
+func ttlFrom(req *http.Request) (time.Duration, bool, error) {
+	value := strings.TrimSpace(req.Header.Get("X-TTL"))
+	if value == "" {
+		value = strings.TrimSpace(req.URL.Query().Get("ttl"))
+	}
+
+	if value == "" {
+		return 0, false, nil
+	}
+
+	ttl, ok := parseDuration(value)
+	if !ok {
+		return 0, false, errBadTTL
+	}
+
+	return ttl, ttl == 0, nil
+}
+
+// parseDuration reads whole seconds or a duration such as 90s or 1h, false
+// if it is neither or negative.
+func parseDuration(value string) (time.Duration, bool) {
+	duration, err := time.ParseDuration(value)
+
+	if seconds, parseErr := strconv.ParseInt(value, 10, 64); parseErr == nil {
+		duration, err = time.Duration(seconds)*time.Second, nil
+	}
+
+	return duration, err == nil && duration >= 0
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTTLFrom(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		header string
+		ttl    time.Duration
+		clear  bool
+		bad    bool
+	}{
+		{name: "Not set", target: "/store/key"},
+		{name: "Seconds", target: "/store/key?ttl=30", ttl: 30 * time.Second},
+		{name: "Duration", target: "/store/key?ttl=1m30s", ttl: 90 * time.Second},
+		{name: "Header", target: "/store/key?ttl=5", header: "10", ttl: 10 * time.Second},
+		{name: "Clear", target: "/store/key?ttl=0", clear: true},
+		{name: "Negative", target: "/store/key?ttl=-5", bad: true},
+		{name: "Bogus", target: "/store/key", header: "soon", bad: true},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("PUT", test.target, nil)
+			if test.header != "" {
+				req.Header.Set("X-TTL", test.header)
+			}
+
+			ttl, clearTTL, err := ttlFrom(req)
+			if (err != nil) != test.bad {
+				t.Fatalf("Expected error %v but got %v", test.bad, err)
+			}
+
+			if ttl != test.ttl || clearTTL != test.clear {
+				t.Errorf("Expected %v clear %v but got %v clear %v", test.ttl, test.clear, ttl, clearTTL)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+// Package handlers reads and writes values in the request and response body.
+package handlers
+
+import (
+	store "KeyValueStoreServer/server/store"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxPresize is the most a value is sized up front from Content-Length when
+// there is no limit, as the header may claim far more than is sent.
+const maxPresize = 1 << 20
+
+// readValue reads the request body as a value, refusing with
+// store.ErrTooLarge one over limit bytes, no limit if zero. The body is
+// streamed straight into the value, sized up front when Content-Length is
+// given, so a large value is only held in memory once. Without a limit it is
+// sized for no more than maxPresize, growing as the rest arrives.
+func readValue(writer http.ResponseWriter, req *http.Request, limit int64) (string, error) {
+	if limit > 0 && req.ContentLength > limit {
+		return "", store.ErrTooLarge
+	}
+
+	body := req.Body
+	if limit > 0 {
+		body = http.MaxBytesReader(writer, req.Body, limit)
+	}
+
+	var value strings.Builder
+
+	if presize := req.ContentLength; presize > 0 {
+		if limit <= 0 && presize > maxPresize {
+			presize = maxPresize
+		}
+
+		value.Grow(int(presize))
+	}
+
+	if _, err := io.Copy(&value, body); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return "", store.ErrTooLarge
+		}
+
+		return "", err
+	}
+
+	return value.String(), nil
+}
+
+// writeValue writes the value, or the part of it asked for by a Range
+// header with a 206 response. A range that cannot be satisfied is refused
+// with 416.
+func writeValue(writer http.ResponseWriter, req *http.Request, value string) {
+	writer.Header().Set("Accept-Ranges", "bytes")
+	http.ServeContent(writer, req, "", time.Time{}, strings.NewReader(value))
+}
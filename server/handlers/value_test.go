@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	store "KeyValueStoreServer/server/store"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReadValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		length  bool
+		claimed int64
+		limit   int64
+		tooLong bool
+	}{
+		{name: "No limit", body: "value", length: true},
+		{name: "Within limit", body: "value", length: true, limit: 5},
+		{name: "Over limit", body: "value", length: true, limit: 4, tooLong: true},
+		{name: "Streamed within limit", body: "value", limit: 5},
+		{name: "Streamed over limit", body: "value", limit: 4, tooLong: true},
+		{name: "Lying length", body: "value", length: true, claimed: 1 << 50},
+		{name: "Lying length within limit", body: "value", length: true, claimed: 1 << 10, limit: 1 << 10},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("PUT", "/store/key", strings.NewReader(test.body))
+			if !test.length {
+				req.ContentLength = -1
+			}
+
+			if test.claimed != 0 {
+				req.ContentLength = test.claimed
+			}
+
+			value, err := readValue(httptest.NewRecorder(), req, test.limit)
+			if test.tooLong {
+				if err != store.ErrTooLarge {
+					t.Errorf("Expected the value to be too large but got %v", err)
+				}
+
+				return
+			}
+
+			if err != nil || value != test.body {
+				t.Errorf("Expected %q but got %q, %v", test.body, value, err)
+			}
+		})
+	}
+}
+
+func TestWriteValue(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		status int
+		body   string
+	}{
+		{name: "Whole value", status: http.StatusOK, body: "0123456789"},
+		{name: "Range", header: "bytes=2-4", status: http.StatusPartialContent, body: "234"},
+		{name: "Suffix", header: "bytes=-3", status: http.StatusPartialContent, body: "789"},
+		{name: "Unsatisfiable", header: "bytes=20-30", status: http.StatusRequestedRangeNotSatisfiable},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/store/key", nil)
+			if test.header != "" {
+				req.Header.Set("Range", test.header)
+			}
+
+			recorder := httptest.NewRecorder()
+			writeValue(recorder, req, "0123456789")
+
+			if recorder.Code != test.status {
+				t.Fatalf("Expected status %d but got %d", test.status, recorder.Code)
+			}
+
+			if test.body != "" && recorder.Body.String() != test.body {
+				t.Errorf("Expected %q but got %q", test.body, recorder.Body.String())
+			}
+		})
+	}
+}
@@ -20,18 +20,21 @@ func main() {
 	go log.WaitForAndProcessRequestLogs()
 	go log.WaitForAndProcesslogs()
 
-	port, depth := getcmdLine()
-
-	// set store depth
-	store.StoreDepth = depth
+	port, opts := getcmdLine()
 
 	log.InfoChannel <- fmt.Sprintf("Starting Server on %d", port)
 
-	// create and monitor a new store
-	go store.PublicAccess.Monitor()
+	// create and monitor a new store, replaying any write-ahead log
+	opts.Warn = func(message string) { log.WarnChannel <- message }
+
+	kvStore, openErr := store.New(opts)
+	if openErr != nil {
+		log.ErrorChannel <- fmt.Sprintf("Error Opening Store %s", openErr)
+		os.Exit(-3)
+	}
 
 	// register endpoint handlers
-	setupHandlers()
+	setupHandlers(handler.New(kvStore))
 
 	server := &http.Server{
 		Addr:              fmt.Sprintf(":%d", port),
@@ -54,18 +57,46 @@ func main() {
 	// close server
 	_ = server.Close()
 
+	// close store
+	kvStore.Close()
+
 	// close loggers
 	log.LoggerDoneChannel <- true
 	log.RequestDoneChannel <- true
 }
 
-func getcmdLine() (int, int) {
+func getcmdLine() (int, store.Options) {
 	var port int
 
-	var storeDepth int
+	var opts store.Options
+
+	var syncPolicy string
+
+	var evictionPolicy string
 
 	flag.IntVar(&port, "port", 0, "port to listen on")
-	flag.IntVar(&storeDepth, "depth", 100, "max values to store default 100")
+	flag.IntVar(&opts.Depth, "depth", store.DefaultDepth, "max values to store default 100")
+	flag.IntVar(&opts.Shards, "shards", store.DefaultShards, "number of shards to split the keys over")
+	flag.IntVar(&opts.ShardDepth, "shard-depth", 0, "max values in each shard, an even split of depth if 0")
+	flag.Int64Var(&opts.MaxBytes, "max-bytes", 0, "memory the keys and values may use, no limit if 0")
+	flag.Int64Var(&opts.MaxValueSize, "max-value-size", 0, "largest value in bytes that may be written, no limit if 0")
+	flag.IntVar(&opts.History, "history", 0, "previous versions of each key to keep")
+	flag.DurationVar(&opts.Retention, "retention", store.DefaultRetention,
+		"how long the store can be read as of an earlier time")
+	flag.IntVar(&opts.ChangeBuffer, "change-buffer", store.DefaultChangeBuffer,
+		"recent changes kept for the change feed")
+	flag.IntVar(&opts.Quota.Keys, "quota-keys", 0, "default max keys each user may own, no limit if 0")
+	flag.Int64Var(&opts.Quota.Bytes, "quota-bytes", 0, "default max value bytes each user may own, no limit if 0")
+	flag.StringVar(&opts.DataDir, "data-dir", "", "directory for the write-ahead log, not persisted if empty")
+	flag.StringVar(&syncPolicy, "fsync", "always", "when to flush the write-ahead log: always, batched or never")
+	flag.StringVar(&evictionPolicy, "policy", "lru", "eviction policy: lru, lfu, fifo, random or arc")
+	flag.Float64Var(&opts.PinnedFraction, "max-pinned", store.DefaultPinnedFraction,
+		"fraction of depth that may be pinned")
+	flag.DurationVar(&opts.SyncInterval, "fsync-interval", store.DefaultSyncInterval,
+		"how often to flush the write-ahead log when batched")
+	flag.DurationVar(&opts.SnapshotInterval, "snapshot-interval", time.Minute,
+		"how often to snapshot the store to the data directory, only on shutdown if 0")
+	flag.IntVar(&opts.SnapshotRetain, "snapshot-retain", store.DefaultSnapshotRetain, "number of snapshots to keep")
 	flag.Parse()
 
 	if port == 0 {
@@ -73,13 +104,43 @@ func getcmdLine() (int, int) {
 		os.Exit(-1)
 	}
 
-	return port, storeDepth
+	policy, err := store.ParseSyncPolicy(syncPolicy)
+	if err != nil {
+		log.ErrorChannel <- fmt.Sprintf("Invalid fsync parameter on command line %s", err)
+		os.Exit(-1)
+	}
+
+	opts.Sync = policy
+
+	newPolicy, err := store.ParsePolicy(evictionPolicy)
+	if err != nil {
+		log.ErrorChannel <- fmt.Sprintf("Invalid policy parameter on command line %s", err)
+		os.Exit(-1)
+	}
+
+	opts.Policy = newPolicy
+
+	return port, opts
 }
 
-func setupHandlers() {
+func setupHandlers(h *handler.Handler) {
 	http.HandleFunc("/ping/", handler.ServePing)
 	http.HandleFunc("/shutdown/", handler.ServeShutdown)
-	http.HandleFunc(fmt.Sprintf("%s/", handler.BaseURLPath), handler.ServeKey)
-	http.HandleFunc("/list/", handler.ServeList)
+	http.HandleFunc(fmt.Sprintf("%s/", handler.BaseURLPath), h.ServeKey)
+	http.HandleFunc("/list/", h.ServeList)
+	http.HandleFunc("/txn", h.ServeTxn)
+	http.HandleFunc(handler.PinURLPath+"/", h.ServePin)
+	http.HandleFunc(handler.ACLURLPath+"/", h.ServeACL)
+	http.HandleFunc(handler.TransferURLPath+"/", h.ServeTransfer)
+	http.HandleFunc(handler.GroupURLPath+"/", h.ServeGroup)
+	http.HandleFunc(handler.HistoryURLPath+"/", h.ServeHistory)
+	http.HandleFunc(handler.QuotaURLPath+"/", h.ServeQuota)
+	http.HandleFunc(handler.WatchURLPath, h.ServeWatch)
+	http.HandleFunc(handler.WatchURLPath+"/", h.ServeWatch)
+	http.HandleFunc(handler.ChangesURLPath, h.ServeChanges)
+	http.HandleFunc(handler.FlushURLPath, h.ServeFlush)
+	http.HandleFunc(handler.OwnedURLPath, h.ServeOwned)
+	http.HandleFunc(handler.ExportURLPath, h.ServeExport)
+	http.HandleFunc(handler.ImportURLPath, h.ServeImport)
 	http.HandleFunc("/login/", handler.ServeLogin)
 }
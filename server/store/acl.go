@@ -0,0 +1,145 @@
+package store
+
+import "errors"
+
+// ErrBadGrant is a grant that cannot be made, such as one to the key's owner.
+var ErrBadGrant = errors.New("bad grant")
+
+// Grant rights over a key given to a user or group other than its owner.
+type Grant struct {
+	Read   bool `json:"read"`
+	Write  bool `json:"write"`
+	Delete bool `json:"delete"`
+}
+
+// ACL the grants on a key by the user or group they are given to.
+type ACL map[string]Grant
+
+// right is something a user may want to do with a key.
+type right int
+
+const (
+	rightRead right = iota
+	rightWrite
+	rightDelete
+)
+
+// clone returns a copy of the ACL, nil if it grants nothing.
+func (a ACL) clone() ACL {
+	if len(a) == 0 {
+		return nil
+	}
+
+	acl := make(ACL, len(a))
+
+	for user, grant := range a {
+		acl[user] = grant
+	}
+
+	return acl
+}
+
+// with returns a copy of the ACL giving grantee grant, dropping them if it
+// grants nothing. The ACL is copied as values sharing it may still be read.
+func (a ACL) with(grantee string, grant Grant) ACL {
+	acl := make(ACL, len(a)+1)
+
+	for user, existing := range a {
+		acl[user] = existing
+	}
+
+	if grant == (Grant{}) {
+		delete(acl, grantee)
+	} else {
+		acl[grantee] = grant
+	}
+
+	if len(acl) == 0 {
+		return nil
+	}
+
+	return acl
+}
+
+// allows reports whether who may exercise right over the value. The owner,
+// or any member of the owning group, may do anything, admin anything but
+// read, as before there were grants, and anyone else only what the ACL grants
+// them or their groups.
+func (d DataValue) allows(who identity, r right) bool {
+	if who.is(d.Owner) || (who.user == admin && r != rightRead) {
+		return true
+	}
+
+	for grantee, grant := range d.ACL {
+		if !who.is(grantee) {
+			continue
+		}
+
+		switch {
+		case r == rightRead && grant.Read,
+			r == rightWrite && grant.Write,
+			r == rightDelete && grant.Delete:
+			return true
+		}
+	}
+
+	return false
+}
+
+// manages reports whether who may see and change the grants on the value.
+func (d DataValue) manages(who identity) bool {
+	return who.is(d.Owner) || who.user == admin
+}
+
+// GrantRequest gives Grantee rights over a key, granting nothing revokes
+// them.
+type GrantRequest struct {
+	Key      string
+	Owner    string
+	Grantee  string
+	Grant    Grant
+	Response chan interface{}
+}
+
+// GrantAccess gives grantee rights over key, only its owner or admin may. The
+// response is the updated DataValue or an error.
+func (s *Store) GrantAccess(key, owner, grantee string, grant Grant) chan interface{} {
+	responseChannel := make(chan interface{})
+	s.shardFor(key).grantChannel <- GrantRequest{
+		Key:      key,
+		Owner:    owner,
+		Grantee:  grantee,
+		Grant:    grant,
+		Response: responseChannel,
+	}
+
+	return responseChannel
+}
+
+func (sh *shard) transactionGrant(msg GrantRequest) {
+	value, ok := sh.lookup(msg.Key)
+
+	switch {
+	case !ok:
+		msg.Response <- ErrNotFound
+		return
+	case !value.manages(sh.store.identify(msg.Owner)):
+		msg.Response <- ErrForbidden
+		return
+	case msg.Grantee == "" || msg.Grantee == value.Owner:
+		msg.Response <- ErrBadGrant
+		return
+	case value.ACL[msg.Grantee] == msg.Grant:
+		msg.Response <- value
+		return
+	}
+
+	value.ACL = value.ACL.with(msg.Grantee, msg.Grant)
+
+	if err := sh.put(msg.Key, &value); err != nil {
+		msg.Response <- err
+		return
+	}
+
+	msg.Response <- value
+}
@@ -0,0 +1,83 @@
+package store
+
+import (
+	"testing"
+)
+
+func TestGrantAccess(t *testing.T) {
+	s := openTestStore(t, Options{Depth: DefaultDepth})
+	defer s.Close()
+
+	<-s.Upsert("key1", "user1", "value")
+
+	if response := <-s.FetchWith(FetchRequest{Key: "key1", Owner: "user2"}); response != nil {
+		t.Errorf("Expected another user not to read an ungranted key but got %v", response)
+	}
+
+	if response := <-s.GrantAccess("key1", "user2", "user2", Grant{Read: true}); response != ErrForbidden {
+		t.Errorf("Expected only the owner to grant access but got %v", response)
+	}
+
+	if response := <-s.GrantAccess("key1", "user1", "user1", Grant{Read: true}); response != ErrBadGrant {
+		t.Errorf("Expected a grant to the owner to be refused but got %v", response)
+	}
+
+	<-s.GrantAccess("key1", "user1", "user2", Grant{Read: true})
+
+	if _, ok := (<-s.FetchWith(FetchRequest{Key: "key1", Owner: "user2"})).(DataValue); !ok {
+		t.Error("Expected a read grant to allow a fetch")
+	}
+
+	if list := <-s.List("user2"); len(list) != 1 || list[0].ACL != nil {
+		t.Errorf("Expected a grantee to list the key without its grants but got %v", list)
+	}
+
+	if list := <-s.ListForKey("key1", "user1"); len(list) != 1 || !list[0].ACL["user2"].Read {
+		t.Errorf("Expected the owner to see the grant but got %v", list)
+	}
+
+	if response := <-s.Upsert("key1", "user2", "value2"); response != ErrForbidden {
+		t.Errorf("Expected a read grant not to allow a write but got %v", response)
+	}
+
+	<-s.GrantAccess("key1", "user1", "user2", Grant{Read: true, Write: true})
+
+	response := <-s.Upsert("key1", "user2", "value2")
+	if value, ok := response.(DataValue); !ok || value.Owner != "user1" || !value.ACL["user2"].Write {
+		t.Errorf("Expected a write grant to update the key keeping its owner and grants but got %v", response)
+	}
+
+	if response = <-s.Delete("key1", "user2"); response != ErrForbidden {
+		t.Errorf("Expected a write grant not to allow a delete but got %v", response)
+	}
+
+	txn := <-s.Transaction(TxnRequest{
+		Owner:      "user2",
+		Operations: []TxnOperation{{Op: TxnGet, Key: "key1"}},
+	})
+	if txn.Err != nil || !*txn.Results[0].Found {
+		t.Errorf("Expected a transaction get to honour the grant but got %v", txn)
+	}
+
+	<-s.GrantAccess("key1", "user1", "user2", Grant{})
+
+	if response = <-s.FetchWith(FetchRequest{Key: "key1", Owner: "user2"}); response != nil {
+		t.Errorf("Expected revoking the grant to stop reads but got %v", response)
+	}
+}
+
+func TestGrantPersisted(t *testing.T) {
+	dir := t.TempDir()
+
+	s := openTestStore(t, Options{Depth: DefaultDepth, DataDir: dir})
+	<-s.Upsert("key1", "user1", "value")
+	<-s.GrantAccess("key1", "user1", "user2", Grant{Delete: true})
+	s.Close()
+
+	s = openTestStore(t, Options{Depth: DefaultDepth, DataDir: dir})
+	defer s.Close()
+
+	if response := <-s.Delete("key1", "user2"); response != nil {
+		t.Errorf("Expected the restored grant to allow a delete but got %v", response)
+	}
+}
@@ -0,0 +1,129 @@
+package store
+
+// arcPolicy is an adaptive replacement cache. Keys used once are kept apart
+// from keys used more than once, and the split between them is tuned by
+// remembering keys recently evicted from each: a key coming back after
+// eviction shows that side of the cache was too small.
+type arcPolicy struct {
+	capacity int
+	// target is the number of keys the once used side aims to hold.
+	target int
+	once   *lruPolicy
+	often  *lruPolicy
+	// ghosts of keys evicted from once and often
+	onceGhosts  *lruPolicy
+	oftenGhosts *lruPolicy
+}
+
+func newARCPolicy(capacity int) *arcPolicy {
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	return &arcPolicy{
+		capacity:    capacity,
+		once:        newLRUPolicy(),
+		often:       newLRUPolicy(),
+		onceGhosts:  newLRUPolicy(),
+		oftenGhosts: newLRUPolicy(),
+	}
+}
+
+// Inserted adds key as used once, unless it was recently evicted in which
+// case the target moves towards the side it came from.
+func (a *arcPolicy) Inserted(key string) {
+	switch {
+	case a.once.has(key) || a.often.has(key):
+		a.Accessed(key)
+		return
+	case a.onceGhosts.has(key):
+		a.target += ratio(a.oftenGhosts.len(), a.onceGhosts.len())
+		if a.target > a.capacity {
+			a.target = a.capacity
+		}
+
+		a.onceGhosts.Removed(key)
+		a.often.Inserted(key)
+	case a.oftenGhosts.has(key):
+		a.target -= ratio(a.onceGhosts.len(), a.oftenGhosts.len())
+		if a.target < 0 {
+			a.target = 0
+		}
+
+		a.oftenGhosts.Removed(key)
+		a.often.Inserted(key)
+	default:
+		a.once.Inserted(key)
+	}
+
+	a.trimGhosts()
+}
+
+// Accessed moves key to the most recently used of the often used side.
+func (a *arcPolicy) Accessed(key string) {
+	if a.once.has(key) {
+		a.once.Removed(key)
+		a.often.Inserted(key)
+
+		return
+	}
+
+	a.often.Accessed(key)
+}
+
+// Removed forgets key entirely, a deleted key is not a sign of the cache
+// being too small.
+func (a *arcPolicy) Removed(key string) {
+	a.once.Removed(key)
+	a.often.Removed(key)
+	a.onceGhosts.Removed(key)
+	a.oftenGhosts.Removed(key)
+}
+
+// Evicted keeps a ghost of key on the side it was evicted from.
+func (a *arcPolicy) Evicted(key string) {
+	switch {
+	case a.once.has(key):
+		a.once.Removed(key)
+		a.onceGhosts.Inserted(key)
+	case a.often.has(key):
+		a.often.Removed(key)
+		a.oftenGhosts.Inserted(key)
+	}
+
+	a.trimGhosts()
+}
+
+// Victim is the least recently used once used key while that side is over
+// its target, otherwise the least recently used often used key.
+func (a *arcPolicy) Victim() (string, bool) {
+	if a.once.len() > 0 && (a.once.len() > a.target || a.often.len() == 0) {
+		return a.once.Victim()
+	}
+
+	return a.often.Victim()
+}
+
+// trimGhosts bounds the ghosts so the policy never remembers more than twice
+// the capacity.
+func (a *arcPolicy) trimGhosts() {
+	for a.once.len()+a.onceGhosts.len() > a.capacity && a.onceGhosts.len() > 0 {
+		key, _ := a.onceGhosts.Victim()
+		a.onceGhosts.Removed(key)
+	}
+
+	for a.once.len()+a.often.len()+a.onceGhosts.len()+a.oftenGhosts.len() > 2*a.capacity &&
+		a.oftenGhosts.len() > 0 {
+		key, _ := a.oftenGhosts.Victim()
+		a.oftenGhosts.Removed(key)
+	}
+}
+
+// ratio is how far to move the target on a ghost hit, at least one.
+func ratio(other, hit int) int {
+	if hit == 0 || other < hit {
+		return 1
+	}
+
+	return other / hit
+}
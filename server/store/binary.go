@@ -0,0 +1,99 @@
+package store
+
+import (
+	"encoding/json"
+	"unicode/utf8"
+)
+
+// Values are held as strings, which Go lets hold any bytes, but JSON strings
+// must be UTF-8 so a value that is not is persisted as base64 in binary
+// instead of value.
+
+// MarshalJSON encodes the value as text if it can, otherwise as base64.
+func (d DataValue) MarshalJSON() ([]byte, error) {
+	type plain DataValue
+
+	encoded := struct {
+		plain
+		Value  string `json:"value,omitempty"`
+		Binary []byte `json:"binary,omitempty"`
+	}{plain: plain(d)}
+
+	encoded.Value, encoded.Binary = splitBinary(d.Value)
+
+	return json.Marshal(encoded)
+}
+
+// UnmarshalJSON decodes a value encoded as text or base64.
+func (d *DataValue) UnmarshalJSON(data []byte) error {
+	type plain DataValue
+
+	var decoded struct {
+		plain
+		Value  string `json:"value"`
+		Binary []byte `json:"binary"`
+	}
+
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	*d = DataValue(decoded.plain)
+	d.Value = joinBinary(decoded.Value, decoded.Binary)
+
+	return nil
+}
+
+// MarshalJSON encodes the revision's value as text if it can, otherwise as
+// base64.
+func (r Revision) MarshalJSON() ([]byte, error) {
+	type plain Revision
+
+	encoded := struct {
+		plain
+		Value  string `json:"value,omitempty"`
+		Binary []byte `json:"binary,omitempty"`
+	}{plain: plain(r)}
+
+	encoded.Value, encoded.Binary = splitBinary(r.Value)
+
+	return json.Marshal(encoded)
+}
+
+// UnmarshalJSON decodes a revision's value encoded as text or base64.
+func (r *Revision) UnmarshalJSON(data []byte) error {
+	type plain Revision
+
+	var decoded struct {
+		plain
+		Value  string `json:"value"`
+		Binary []byte `json:"binary"`
+	}
+
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	*r = Revision(decoded.plain)
+	r.Value = joinBinary(decoded.Value, decoded.Binary)
+
+	return nil
+}
+
+// splitBinary returns value as text if it is valid UTF-8, otherwise as bytes.
+func splitBinary(value string) (string, []byte) {
+	if utf8.ValidString(value) {
+		return value, nil
+	}
+
+	return "", []byte(value)
+}
+
+// joinBinary reverses splitBinary.
+func joinBinary(text string, binary []byte) string {
+	if binary != nil {
+		return string(binary)
+	}
+
+	return text
+}
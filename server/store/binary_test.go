@@ -0,0 +1,38 @@
+package store
+
+import (
+	"testing"
+)
+
+func TestBinaryValues(t *testing.T) {
+	dir := t.TempDir()
+
+	s := openTestStore(t, Options{Depth: DefaultDepth, DataDir: dir, History: 1})
+
+	binary := string([]byte{0x00, 0xff, 0xfe, 'a', 0x80})
+
+	<-s.UpsertWith(UpsertRequest{Key: "key1", Owner: "user1", Value: binary, ContentType: "application/octet-stream"})
+	<-s.UpsertWith(UpsertRequest{
+		Key: "key1", Owner: "user1", Value: "text", ContentType: "text/plain", ContentEncoding: "gzip",
+	})
+
+	s.Close()
+
+	s = openTestStore(t, Options{Depth: DefaultDepth, DataDir: dir, History: 1})
+	defer s.Close()
+
+	value, ok := (<-s.Fetch("key1")).(DataValue)
+	if !ok || value.Value != "text" || value.ContentType != "text/plain" || value.ContentEncoding != "gzip" {
+		t.Errorf("Expected the value to keep its content type and encoding but got %v", value)
+	}
+
+	previous, ok := (<-s.FetchWith(FetchRequest{Key: "key1", Version: value.Version - 1})).(DataValue)
+	if !ok || previous.Value != binary || previous.ContentType != "application/octet-stream" ||
+		previous.ContentEncoding != "" {
+		t.Errorf("Expected the binary value to survive a restart but got %v", previous)
+	}
+
+	if list := <-s.List("user1"); len(list) != 1 || list[0].Size != len("text") {
+		t.Errorf("Expected the size of the value to be listed but got %v", list)
+	}
+}
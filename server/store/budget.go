@@ -0,0 +1,199 @@
+package store
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// ErrTooLarge is a value that could never fit within the store's memory budget,
+// or is larger than it takes.
+var ErrTooLarge = errors.New("value too large")
+
+// errNoRoom is a write its shard cannot make room for by evicting its own
+// keys, so it has to be tried again evicting from every shard.
+var errNoRoom = errors.New("no room in shard")
+
+// entryOverhead approximates the memory taken by an entry beyond its key,
+// value and owner: the fixed size fields of a DataValue, the string headers
+// and the map and eviction policy bookkeeping.
+const entryOverhead = 128
+
+// entrySize approximates the memory used by key and value, including the
+// previous versions kept.
+func entrySize(key string, value DataValue) int64 {
+	return int64(len(key)+len(value.Value)+len(value.Owner)+entryOverhead) + value.historySize()
+}
+
+// MaxValueSize is the largest value in bytes the store takes, zero if there
+// is no limit.
+func (s *Store) MaxValueSize() int64 {
+	return s.maxValueSize
+}
+
+// tooLarge reports whether value is larger than the store takes.
+func (s *Store) tooLarge(value string) bool {
+	return s.maxValueSize > 0 && int64(len(value)) > s.maxValueSize
+}
+
+// overBudget reports whether the store uses more memory than it may.
+func (s *Store) overBudget() bool {
+	return s.maxBytes > 0 && atomic.LoadInt64(&s.bytes) > s.maxBytes
+}
+
+// checkRetained has the versions kept only for reads of the past dropped if
+// together with the keys they take the store over its memory budget. Reads
+// as of before then are refused from then on.
+func (s *Store) checkRetained() {
+	if s.maxBytes > 0 && atomic.LoadInt64(&s.bytes)+atomic.LoadInt64(&s.versions.retained) > s.maxBytes {
+		s.versions.squeeze()
+	}
+}
+
+// shortOf returns how many keys and how much memory the store must free
+// before key can hold a value of size.
+func (sh *shard) shortOf(key string, size int64) (int64, int64) {
+	var keys, bytes int64
+
+	if _, held := sh.value[key]; !held {
+		keys = atomic.LoadInt64(&sh.store.count) + 1 - int64(sh.store.depth)
+	}
+
+	if sh.store.maxBytes > 0 {
+		bytes = atomic.LoadInt64(&sh.store.bytes) + size - sh.size(key) - sh.store.maxBytes
+	}
+
+	if keys < 0 {
+		keys = 0
+	}
+
+	if bytes < 0 {
+		bytes = 0
+	}
+
+	return keys, bytes
+}
+
+// room checks, before anything is evicted, that there is or can be made room
+// for key to hold a value of size. Unless every shard is paused only this
+// shard's keys are counted, errNoRoom meaning evicting from the others too
+// is needed. Then the others are evicted from, the oldest victim first,
+// until there is room. ErrStoreFull is returned if even evicting every key
+// the policies may would not make room, nothing having been evicted.
+func (sh *shard) room(key string, size int64) error {
+	if sh.store.maxBytes > 0 && size > sh.store.maxBytes {
+		return ErrTooLarge
+	}
+
+	keys, bytes := sh.shortOf(key, size)
+
+	// the key itself may be evicted but that frees nothing for it
+	spareKeys, spareBytes := sh.evictableKeys, sh.evictableBytes
+
+	current, held := sh.value[key]
+	if held && !current.Pinned {
+		spareKeys--
+		spareBytes -= entrySize(key, current)
+	}
+
+	// a shard at its own depth can only evict its own keys
+	if !held && len(sh.value) >= sh.depth {
+		if spareKeys == 0 {
+			return ErrStoreFull
+		}
+
+		if keys == 0 {
+			keys = 1
+		}
+	}
+
+	if spareKeys >= keys && spareBytes >= bytes {
+		return nil
+	}
+
+	if !sh.across {
+		return errNoRoom
+	}
+
+	for _, other := range sh.store.shards {
+		if other != sh {
+			spareKeys += other.evictableKeys
+			spareBytes += other.evictableBytes
+		}
+	}
+
+	if spareKeys < keys || spareBytes < bytes {
+		return ErrStoreFull
+	}
+
+	for keys, bytes = sh.shortOf(key, size); keys > 0 || bytes > 0; keys, bytes = sh.shortOf(key, size) {
+		victim := sh.store.oldestVictim()
+		if victim == nil {
+			return ErrStoreFull
+		}
+
+		if err := victim.evict(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// acrossShards runs write, a write to sh that failed with errNoRoom, again
+// with every shard paused so it may evict from any of them.
+func (s *Store) acrossShards(sh *shard, write func()) {
+	resume := s.pause()
+	defer resume()
+
+	sh.across = true
+	defer func() { sh.across = false }()
+
+	write()
+}
+
+// makeRoom claims the memory to store value for key, evicting from this shard
+// until the store has it, and returns the change in memory claimed. Room has
+// already checked this shard can free enough, or freed it from every shard,
+// so this only runs out of keys to evict if other shards took the memory
+// meanwhile. The key itself may be evicted if the policy chooses it.
+func (sh *shard) makeRoom(key string, value DataValue) (int64, error) {
+	size := entrySize(key, value)
+
+	if sh.store.maxBytes == 0 {
+		delta := size - sh.size(key)
+		atomic.AddInt64(&sh.store.bytes, delta)
+
+		return delta, nil
+	}
+
+	if size > sh.store.maxBytes {
+		return 0, ErrTooLarge
+	}
+
+	for {
+		bytes := atomic.LoadInt64(&sh.store.bytes)
+		delta := size - sh.size(key)
+
+		if bytes+delta <= sh.store.maxBytes || delta <= 0 {
+			if atomic.CompareAndSwapInt64(&sh.store.bytes, bytes, bytes+delta) {
+				return delta, nil
+			}
+
+			continue
+		}
+
+		if err := sh.evict(); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// size is the memory used by key, zero if the shard does not hold it.
+func (sh *shard) size(key string) int64 {
+	value, ok := sh.value[key]
+	if !ok {
+		return 0
+	}
+
+	return entrySize(key, value)
+}
@@ -0,0 +1,149 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// budgetFor is room for count entries with keys like key1 and values of size.
+func budgetFor(count, size int) int64 {
+	return int64(count) * entrySize("key1", DataValue{Owner: "user1", Value: strings.Repeat("v", size)})
+}
+
+func TestBudgetEviction(t *testing.T) {
+	s := openTestStore(t, Options{Depth: DefaultDepth, MaxBytes: budgetFor(3, 100)})
+	defer s.Close()
+
+	value := strings.Repeat("v", 100)
+
+	for _, key := range []string{"key1", "key2", "key3", "key4"} {
+		if _, ok := (<-s.Upsert(key, "user1", value)).(DataValue); !ok {
+			t.Fatalf("Expected %s to be stored", key)
+		}
+	}
+
+	if response := <-s.Fetch("key1"); response != nil {
+		t.Errorf("Expected the least recently used key to be evicted but got %v", response)
+	}
+
+	// growing a key makes room by evicting others
+	if _, ok := (<-s.Upsert("key4", "user1", strings.Repeat("v", 250))).(DataValue); !ok {
+		t.Fatal("Expected the larger value to be stored")
+	}
+
+	if response := <-s.Fetch("key2"); response != nil {
+		t.Errorf("Expected key2 to be evicted for the larger value but got %v", response)
+	}
+
+	if s.bytes > s.maxBytes {
+		t.Errorf("Expected the store to be within its budget of %d but used %d", s.maxBytes, s.bytes)
+	}
+
+	<-s.Delete("key3", "user1")
+	<-s.Delete("key4", "user1")
+
+	if s.bytes != 0 {
+		t.Errorf("Expected no memory used once empty but got %d", s.bytes)
+	}
+}
+
+func TestBudgetTooLarge(t *testing.T) {
+	s := openTestStore(t, Options{Depth: DefaultDepth, MaxBytes: budgetFor(2, 100)})
+	defer s.Close()
+
+	<-s.Upsert("key1", "user1", "small")
+
+	if response := <-s.Upsert("key2", "user1", strings.Repeat("v", 1000)); response != ErrTooLarge {
+		t.Errorf("Expected a value larger than the budget to be too large but got %v", response)
+	}
+
+	if _, ok := (<-s.Fetch("key1")).(DataValue); !ok {
+		t.Error("Expected a value too large to leave the store alone")
+	}
+
+	response := <-s.Transaction(TxnRequest{
+		Owner:      "user1",
+		Operations: []TxnOperation{{Op: TxnPut, Key: "key2", Value: strings.Repeat("v", 1000)}},
+	})
+	if !errors.Is(response.Err, ErrTooLarge) {
+		t.Errorf("Expected a transaction writing too large a value to fail but got %v", response.Err)
+	}
+}
+
+func TestBudgetRestore(t *testing.T) {
+	dir := t.TempDir()
+	value := strings.Repeat("v", 100)
+
+	s := openTestStore(t, Options{Depth: DefaultDepth, DataDir: dir})
+	for _, key := range []string{"key1", "key2", "key3", "key4"} {
+		<-s.Upsert(key, "user1", value)
+	}
+	s.Close()
+
+	s = openTestStore(t, Options{Depth: DefaultDepth, DataDir: dir, MaxBytes: budgetFor(2, 100)})
+	defer s.Close()
+
+	if s.count != 2 || s.bytes > s.maxBytes {
+		t.Errorf("Expected a lowered budget to trim to 2 keys but got %d using %d", s.count, s.bytes)
+	}
+}
+
+func TestMaxValueSize(t *testing.T) {
+	s := openTestStore(t, Options{Depth: DefaultDepth, MaxValueSize: 5})
+	defer s.Close()
+
+	if response := <-s.Upsert("key1", "user1", "value"); !stored(response) {
+		t.Errorf("Expected a value of the largest size to be stored but got %v", response)
+	}
+
+	if response := <-s.Upsert("key1", "user1", "values"); response != ErrTooLarge {
+		t.Errorf("Expected a larger value to be refused but got %v", response)
+	}
+
+	response := <-s.Transaction(TxnRequest{
+		Owner:      "user1",
+		Operations: []TxnOperation{{Op: TxnPut, Key: "key2", Value: "values"}},
+	})
+	if !errors.Is(response.Err, ErrTooLarge) {
+		t.Errorf("Expected a larger value in a transaction to be refused but got %v", response.Err)
+	}
+}
+
+func TestBudgetEvictsAcrossShards(t *testing.T) {
+	s := openTestStore(t, Options{Depth: 1000, Shards: 4, MaxBytes: 20000})
+	defer s.Close()
+
+	value := strings.Repeat("v", 100)
+
+	for i := 0; i < 100; i++ {
+		<-s.Upsert(fmt.Sprintf("key%d", i), "user1", value)
+	}
+
+	// more than any one shard holds has to be evicted for the value
+	if response := <-s.Upsert("large", "user1", strings.Repeat("v", 12000)); !stored(response) {
+		t.Fatalf("Expected a value within the budget to be stored but got %v", response)
+	}
+
+	if s.bytes > s.maxBytes {
+		t.Errorf("Expected the store to be within its budget of %d but used %d", s.maxBytes, s.bytes)
+	}
+
+	// a write there is no room for however much is evicted evicts nothing
+	for i := 0; i < 100; i++ {
+		<-s.Pin(fmt.Sprintf("key%d", i), "user1", true)
+	}
+
+	<-s.Pin("large", "user1", true)
+
+	before := s.seq
+
+	if response := <-s.Upsert("another", "user1", strings.Repeat("v", 12000)); response != ErrStoreFull {
+		t.Errorf("Expected a value there is no room for to be refused but got %v", response)
+	}
+
+	if page, err := s.Changes(admin, before, 0); err != nil || len(page.Changes) != 0 {
+		t.Errorf("Expected a refused write to leave no changes but got %v, %v", page.Changes, err)
+	}
+}
@@ -0,0 +1,135 @@
+package store
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// DefaultChangeBuffer how many recent changes are kept when no size is
+// given.
+const DefaultChangeBuffer = 10000
+
+// ErrResync is a change feed read from before the oldest change still kept,
+// the reader having to list the store again and carry on from there.
+var ErrResync = errors.New("too old, resync")
+
+// Changes a page of the change feed. Next is the sequence number to read on
+// from for the following page.
+type Changes struct {
+	Changes []Event `json:"changes"`
+	Next    uint64  `json:"next"`
+}
+
+// changeRing keeps the most recent changes in sequence order. Floor is the
+// sequence number of the newest change no longer kept, or the last one made
+// before the store was restored, and last the newest sequence number seen.
+type changeRing struct {
+	mutex  sync.Mutex
+	events []Event
+	start  int
+	count  int
+	floor  uint64
+	last   uint64
+}
+
+func newChangeRing(size int) *changeRing {
+	if size <= 0 {
+		size = DefaultChangeBuffer
+	}
+
+	return &changeRing{events: make([]Event, size)}
+}
+
+// reset empties the ring, changes up to seq being lost.
+func (c *changeRing) reset(seq uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.start, c.count, c.floor, c.last = 0, 0, seq, seq
+}
+
+// add records events, overwriting the oldest when full. Seq is the sequence
+// number of the last record committed with them. It is only called with the
+// store's commitMutex held so the ring stays in order.
+func (c *changeRing) add(events []Event, seq uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, event := range events {
+		i := (c.start + c.count) % len(c.events)
+
+		if c.count == len(c.events) {
+			c.floor = c.events[c.start].Seq
+			c.start = (c.start + 1) % len(c.events)
+		} else {
+			c.count++
+		}
+
+		c.events[i] = event
+	}
+
+	c.last = seq
+}
+
+// at returns the ith change kept, oldest first.
+func (c *changeRing) at(i int) Event {
+	return c.events[(c.start+i)%len(c.events)]
+}
+
+// after returns the changes kept after since that want, oldest first,
+// ErrResync if changes after since are no longer kept.
+func (c *changeRing) after(since uint64, want func(event Event) bool) ([]Event, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if since < c.floor {
+		return nil, ErrResync
+	}
+
+	var events []Event
+
+	for i := sort.Search(c.count, func(i int) bool { return c.at(i).Seq > since }); i < c.count; i++ {
+		if event := c.at(i); want(event) {
+			events = append(events, event)
+		}
+	}
+
+	return events, nil
+}
+
+// Changes pages through the changes made after since, oldest first, no more
+// than limit of them if it is set. Admin sees every change, anyone else only
+// the changes to keys they may read. The response is ErrResync if changes
+// after since are no longer kept.
+func (s *Store) Changes(owner string, since uint64, limit int) (Changes, error) {
+	who := s.identify(owner)
+	c := s.changes
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if since < c.floor {
+		return Changes{}, ErrResync
+	}
+
+	page := Changes{Changes: []Event{}, Next: c.last}
+
+	first := sort.Search(c.count, func(i int) bool { return c.at(i).Seq > since })
+
+	for i := first; i < c.count; i++ {
+		event := c.at(i)
+
+		if limit > 0 && len(page.Changes) == limit {
+			// carry on after the last change returned
+			page.Next = page.Changes[len(page.Changes)-1].Seq
+			break
+		}
+
+		if who.user == admin || event.visible(who) {
+			page.Changes = append(page.Changes, event)
+		}
+	}
+
+	return page, nil
+}
@@ -0,0 +1,64 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestChanges(t *testing.T) {
+	s := openTestStore(t, Options{Depth: DefaultDepth, ChangeBuffer: 4})
+	defer s.Close()
+
+	<-s.Upsert("key1", "user1", "value")
+	<-s.Upsert("key2", "user2", "value")
+	<-s.Delete("key1", "user1")
+
+	page, err := s.Changes(admin, 0, 2)
+	if err != nil || len(page.Changes) != 2 || page.Changes[0].Key != "key1" || page.Next != page.Changes[1].Seq {
+		t.Fatalf("Expected the first two changes but got %v, %v", page, err)
+	}
+
+	page, _ = s.Changes(admin, page.Next, 2)
+	if len(page.Changes) != 1 || page.Changes[0].Type != EventDelete || page.Changes[0].Owner != "user1" {
+		t.Errorf("Expected the delete to follow but got %v", page)
+	}
+
+	if page, _ = s.Changes("user1", 0, 0); len(page.Changes) != 2 {
+		t.Errorf("Expected user1 to only see changes to their own key but got %v", page)
+	}
+
+	for i := 0; i < 4; i++ {
+		<-s.Upsert(fmt.Sprintf("key%d", i+3), "user1", "value")
+	}
+
+	if _, err = s.Changes(admin, 0, 0); err != ErrResync {
+		t.Errorf("Expected reading changes no longer kept to need a resync but got %v", err)
+	}
+
+	page, err = s.Changes(admin, 3, 0)
+	if err != nil || len(page.Changes) != 4 || page.Next != page.Changes[3].Seq {
+		t.Errorf("Expected the changes still kept but got %v, %v", page, err)
+	}
+}
+
+func TestChangesAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	s := openTestStore(t, Options{Depth: DefaultDepth, DataDir: dir})
+	<-s.Upsert("key1", "user1", "value")
+	s.Close()
+
+	s = openTestStore(t, Options{Depth: DefaultDepth, DataDir: dir})
+	defer s.Close()
+
+	if _, err := s.Changes(admin, 0, 0); err != ErrResync {
+		t.Errorf("Expected changes from before a restart to need a resync but got %v", err)
+	}
+
+	stored, _ := (<-s.Upsert("key2", "user1", "value")).(DataValue)
+
+	page, err := s.Changes(admin, stored.Version-1, 0)
+	if err != nil || len(page.Changes) != 1 || page.Changes[0].Seq != stored.Version {
+		t.Errorf("Expected the change after the restart to carry on the sequence but got %v, %v", page, err)
+	}
+}
@@ -0,0 +1,90 @@
+package store
+
+import (
+	"container/heap"
+	"fmt"
+	"time"
+)
+
+// expiryItem a key due to expire at a time in unix nanoseconds.
+type expiryItem struct {
+	key string
+	at  int64
+}
+
+// expiryQueue is a min heap of keys by expiry. Items are not removed when a
+// key is deleted or its expiry changes, they are checked against the key when
+// they come due instead.
+type expiryQueue []expiryItem
+
+func (q expiryQueue) Len() int            { return len(q) }
+func (q expiryQueue) Less(i, j int) bool  { return q[i].at < q[j].at }
+func (q expiryQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *expiryQueue) Push(x interface{}) { *q = append(*q, x.(expiryItem)) }
+
+func (q *expiryQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+
+	return item
+}
+
+// expired reports whether the value has an expiry that has passed.
+func (d DataValue) expired(now int64) bool {
+	return d.Expires != 0 && d.Expires <= now
+}
+
+// lookup returns the value held for key unless it has expired.
+func (sh *shard) lookup(key string) (DataValue, bool) {
+	value, ok := sh.value[key]
+	if !ok || value.expired(time.Now().UnixNano()) {
+		return DataValue{}, false
+	}
+
+	return value, true
+}
+
+// schedule queues key to expire at, unix nanoseconds, waking the shard
+// earlier than planned if need be.
+func (sh *shard) schedule(key string, at int64) {
+	heap.Push(&sh.expiries, expiryItem{key: key, at: at})
+
+	if sh.wake == nil || at < sh.wakeAt {
+		sh.arm()
+	}
+}
+
+// arm sets the timer for the next key due to expire.
+func (sh *shard) arm() {
+	if sh.timer != nil {
+		sh.timer.Stop()
+	}
+
+	if len(sh.expiries) == 0 {
+		sh.timer, sh.wake, sh.wakeAt = nil, nil, 0
+		return
+	}
+
+	sh.wakeAt = sh.expiries[0].at
+	sh.timer = time.NewTimer(time.Duration(sh.wakeAt - time.Now().UnixNano()))
+	sh.wake = sh.timer.C
+}
+
+// sweep removes every key that has expired then sets the timer for the next.
+func (sh *shard) sweep() {
+	now := time.Now().UnixNano()
+
+	for len(sh.expiries) > 0 && sh.expiries[0].at <= now {
+		item, _ := heap.Pop(&sh.expiries).(expiryItem)
+
+		// skip items left behind by keys since deleted or given a new expiry
+		if value, ok := sh.value[item.key]; ok && value.Expires == item.at {
+			if err := sh.expire(item.key); err != nil {
+				sh.store.warn(fmt.Sprintf("Error expiring %s %v", item.key, err))
+			}
+		}
+	}
+
+	sh.arm()
+}
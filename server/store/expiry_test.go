@@ -0,0 +1,116 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+const testTTL = 50 * time.Millisecond
+
+func TestExpirySweep(t *testing.T) {
+	s := openTestStore(t, Options{Depth: DefaultDepth})
+	defer s.Close()
+
+	<-s.UpsertWith(UpsertRequest{Key: "short", Owner: "user1", Value: "value", TTL: testTTL})
+	<-s.Upsert("forever", "user1", "value")
+
+	if _, ok := (<-s.Fetch("short")).(DataValue); !ok {
+		t.Fatal("Expected the key to be readable before it expires")
+	}
+
+	time.Sleep(3 * testTTL)
+
+	if response := <-s.Fetch("short"); response != nil {
+		t.Errorf("Expected an expired key not to be served but got %v", response)
+	}
+
+	resume := s.pause()
+	_, held := s.shardFor("short").value["short"]
+	count := s.count
+	resume()
+
+	if held || count != 1 {
+		t.Errorf("Expected the sweeper to remove the key leaving 1 but held %v with %d", held, count)
+	}
+}
+
+func TestExpiryNeverServed(t *testing.T) {
+	s := openTestStore(t, Options{Depth: DefaultDepth})
+	defer s.Close()
+
+	<-s.UpsertWith(UpsertRequest{Key: "key1", Owner: "user1", Value: "value", TTL: time.Hour})
+
+	// expire the key without waiting for the sweeper
+	resume := s.pause()
+	sh := s.shardFor("key1")
+	value := sh.value["key1"]
+	value.Expires = time.Now().UnixNano() - 1
+	sh.value["key1"] = value
+	resume()
+
+	if response := <-s.Fetch("key1"); response != nil {
+		t.Errorf("Expected fetch to skip an expired key but got %v", response)
+	}
+
+	if list := <-s.List(admin); len(list) != 0 {
+		t.Errorf("Expected list to skip an expired key but got %v", list)
+	}
+
+	if response := <-s.Delete("key1", "user1"); response != ErrNotFound {
+		t.Errorf("Expected deleting an expired key to be not found but got %v", response)
+	}
+
+	response := <-s.Upsert("key1", "user2", "value2")
+	if stored, ok := response.(DataValue); !ok || stored.Owner != "user2" || stored.Writes != 1 {
+		t.Errorf("Expected an expired key to be replaced as new but got %v", response)
+	}
+}
+
+func TestExpiryKeepAndClear(t *testing.T) {
+	s := openTestStore(t, Options{Depth: DefaultDepth})
+	defer s.Close()
+
+	first, _ := (<-s.UpsertWith(UpsertRequest{Key: "key1", Owner: "user1", Value: "v1", TTL: time.Hour})).(DataValue)
+
+	kept, _ := (<-s.Upsert("key1", "user1", "v2")).(DataValue)
+	if kept.Expires != first.Expires {
+		t.Errorf("Expected an update without a TTL to keep expiry %d but got %d", first.Expires, kept.Expires)
+	}
+
+	list := <-s.ListForKey("key1", "user1")
+	if len(list) != 1 || list[0].ExpiresIn == nil || *list[0].ExpiresIn <= 0 ||
+		*list[0].ExpiresIn > time.Hour.Milliseconds() {
+		t.Errorf("Expected list to report expires_in within the hour but got %v", list)
+	}
+
+	cleared, _ := (<-s.UpsertWith(UpsertRequest{Key: "key1", Owner: "user1", Value: "v3", ClearTTL: true})).(DataValue)
+	if cleared.Expires != 0 {
+		t.Errorf("Expected clearing the TTL to leave no expiry but got %d", cleared.Expires)
+	}
+
+	if list = <-s.ListForKey("key1", "user1"); len(list) != 1 || list[0].ExpiresIn != nil {
+		t.Errorf("Expected no expires_in once cleared but got %v", list)
+	}
+}
+
+func TestExpiryReplay(t *testing.T) {
+	dir := t.TempDir()
+
+	s := openTestStore(t, Options{Depth: DefaultDepth, DataDir: dir})
+	<-s.UpsertWith(UpsertRequest{Key: "short", Owner: "user1", Value: "value", TTL: testTTL})
+	<-s.UpsertWith(UpsertRequest{Key: "long", Owner: "user1", Value: "value", TTL: time.Hour})
+	s.Close()
+
+	time.Sleep(2 * testTTL)
+
+	s = openTestStore(t, Options{Depth: DefaultDepth, DataDir: dir})
+	defer s.Close()
+
+	if response := <-s.Fetch("short"); response != nil {
+		t.Errorf("Expected a key that expired while closed not to be served but got %v", response)
+	}
+
+	if value, ok := (<-s.Fetch("long")).(DataValue); !ok || value.Expires == 0 {
+		t.Errorf("Expected a restored key to keep its expiry but got %v", value)
+	}
+}
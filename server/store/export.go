@@ -0,0 +1,153 @@
+package store
+
+import (
+	"errors"
+	"time"
+)
+
+// exportChunk how many entries are copied from a shard each time it is held.
+const exportChunk = 256
+
+// ErrKeyExists is an import of a key the store already has without leave to
+// overwrite it.
+var ErrKeyExists = errors.New("key exists")
+
+// ErrBadImport is an imported entry without a key.
+var ErrBadImport = errors.New("bad import")
+
+// ExportEntry a key and everything stored for it.
+type ExportEntry struct {
+	Key   string    `json:"key"`
+	Entry DataValue `json:"entry"`
+}
+
+// ImportOptions how an entry is imported. Overwrite replaces a key the store
+// already has, otherwise SkipExisting leaves it alone and without either the
+// import fails. PreserveOwner keeps the owner, grants and writer of the
+// entry, otherwise the key is owned by whoever imports it.
+type ImportOptions struct {
+	Overwrite     bool
+	SkipExisting  bool
+	PreserveOwner bool
+}
+
+// Export passes every entry to write, shard by shard and in key order within
+// each. Only a few entries are copied at a time, the shard being held only
+// while they are, so the store carries on while the export is written out
+// and each entry is exported as it was when copied. Only admin may.
+func (s *Store) Export(caller string, write func(ExportEntry) error) error {
+	if caller != admin {
+		return ErrForbidden
+	}
+
+	for _, sh := range s.shards {
+		after := ""
+
+		for more := true; more; {
+			var chunk []ExportEntry
+
+			chunk, more = sh.copyChunk(after)
+
+			for _, entry := range chunk {
+				if err := write(entry); err != nil {
+					return err
+				}
+			}
+
+			if len(chunk) > 0 {
+				after = chunk[len(chunk)-1].Key
+			}
+		}
+	}
+
+	return nil
+}
+
+// copyChunk copies up to exportChunk entries after the key after, or from the
+// first if it is empty, while the shard is paused, and reports whether there
+// are more.
+func (sh *shard) copyChunk(after string) ([]ExportEntry, bool) {
+	resume := make(chan struct{})
+	sh.pause(resume)
+
+	defer close(resume)
+
+	now := time.Now().UnixNano()
+	chunk := make([]ExportEntry, 0, exportChunk)
+
+	node := sh.keys.seek(after, nil)
+	for ; node != nil && len(chunk) < exportChunk; node = node.next[0] {
+		if value := sh.value[node.key]; node.key != after && !value.expired(now) {
+			chunk = append(chunk, ExportEntry{Key: node.key, Entry: value})
+		}
+	}
+
+	return chunk, node != nil
+}
+
+// Import stores an exported entry, keeping its counters, timestamps, expiry
+// and history, and reports whether it was stored or skipped. Pins are not
+// imported. The entry is charged to its owner's quota and the store makes
+// room for it as for any write. Only admin may.
+func (s *Store) Import(caller string, entry ExportEntry, opts ImportOptions) (bool, error) {
+	if caller != admin {
+		return false, ErrForbidden
+	}
+
+	if entry.Key == "" {
+		return false, ErrBadImport
+	}
+
+	if s.tooLarge(entry.Entry.Value) {
+		return false, ErrTooLarge
+	}
+
+	sh := s.shardFor(entry.Key)
+
+	resume := make(chan struct{})
+	sh.pause(resume)
+
+	stored, err := sh.importEntry(caller, entry, opts)
+
+	close(resume)
+
+	if errors.Is(err, errNoRoom) {
+		s.acrossShards(sh, func() { stored, err = sh.importEntry(caller, entry, opts) })
+	}
+
+	return stored, err
+}
+
+// importEntry stores an entry for Import, the shard being held.
+func (sh *shard) importEntry(caller string, entry ExportEntry, opts ImportOptions) (bool, error) {
+	current, ok := sh.lookup(entry.Key)
+
+	switch {
+	case ok && opts.Overwrite:
+	case ok && opts.SkipExisting:
+		return false, nil
+	case ok:
+		return false, ErrKeyExists
+	}
+
+	value := entry.Entry
+	value.Pinned = false
+
+	if !opts.PreserveOwner {
+		value.Owner = caller
+		value.Writer = caller
+		value.ACL = nil
+		value.Offer = ""
+	}
+
+	// an overwritten key stays pinned as it was
+	if ok && current.Pinned {
+		value.Pinned = true
+	}
+
+	if err := sh.write(entry.Key, &value, current, ok); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestExportImport(t *testing.T) {
+	from := openTestStore(t, Options{Depth: 1000, Shards: 2})
+	defer from.Close()
+
+	for i := 0; i < 600; i++ {
+		<-from.Upsert(fmt.Sprintf("key%d", i), "user1", "value")
+	}
+
+	<-from.Upsert("binary", "user2", string([]byte{0xff, 0x00}))
+	<-from.Fetch("binary")
+
+	if err := from.Export("user1", func(ExportEntry) error { return nil }); err != ErrForbidden {
+		t.Errorf("Expected only admin to export but got %v", err)
+	}
+
+	var lines [][]byte
+
+	err := from.Export(admin, func(entry ExportEntry) error {
+		line, err := json.Marshal(entry)
+		lines = append(lines, line)
+
+		return err
+	})
+	if err != nil || len(lines) != 601 {
+		t.Fatalf("Expected every entry to be exported but got %d, %v", len(lines), err)
+	}
+
+	to := openTestStore(t, Options{Depth: 1000})
+	defer to.Close()
+
+	<-to.Upsert("key1", "user3", "existing")
+
+	var imported, skipped int
+
+	for _, line := range lines {
+		var entry ExportEntry
+		if err = json.Unmarshal(line, &entry); err != nil {
+			t.Fatalf("Expected an exported line to decode but got %v", err)
+		}
+
+		stored, err := to.Import(admin, entry, ImportOptions{SkipExisting: true, PreserveOwner: true})
+		if err != nil {
+			t.Fatalf("Expected %s to import but got %v", entry.Key, err)
+		}
+
+		if stored {
+			imported++
+		} else {
+			skipped++
+		}
+	}
+
+	if imported != 600 || skipped != 1 {
+		t.Errorf("Expected one existing key to be skipped but got %d imported, %d skipped", imported, skipped)
+	}
+
+	value, ok := (<-to.FetchWith(FetchRequest{Key: "binary", Owner: "user2"})).(DataValue)
+	if !ok || value.Value != string([]byte{0xff, 0x00}) || value.Reads != 2 {
+		t.Errorf("Expected the value, owner and counters to be imported but got %v", value)
+	}
+
+	entry := ExportEntry{Key: "key1", Entry: DataValue{Owner: "user1", Value: "imported"}}
+
+	if _, err = to.Import(admin, entry, ImportOptions{}); err != ErrKeyExists {
+		t.Errorf("Expected importing an existing key to fail but got %v", err)
+	}
+
+	if _, err = to.Import(admin, entry, ImportOptions{Overwrite: true}); err != nil {
+		t.Errorf("Expected overwriting an existing key but got %v", err)
+	}
+
+	if value, _ = (<-to.Fetch("key1")).(DataValue); value.Value != "imported" || value.Owner != admin {
+		t.Errorf("Expected the key to be overwritten and owned by whoever imported it but got %v", value)
+	}
+
+	if usage, _ := to.Usage(admin, "user1"); usage.Keys != 599 {
+		t.Errorf("Expected imported keys to count towards their owner's usage but got %v", usage)
+	}
+}
@@ -0,0 +1,56 @@
+package store
+
+import (
+	"strings"
+	"time"
+)
+
+// Flush deletes every key starting with prefix, every key if it is empty,
+// atomically, and returns how many there were. Only admin may.
+func (s *Store) Flush(caller, prefix string) (int, error) {
+	if caller != admin {
+		return 0, ErrForbidden
+	}
+
+	return s.deleteWhere(s.identify(caller), prefix, func(DataValue) bool { return true })
+}
+
+// DeleteOwned deletes every key owner owns, atomically, and returns how many
+// there were. Keys owned by a group owner belongs to are left alone.
+func (s *Store) DeleteOwned(owner string) (int, error) {
+	return s.deleteWhere(s.identify(owner), "", func(value DataValue) bool { return value.Owner == owner })
+}
+
+// deleteWhere deletes the keys starting with prefix that match and who may
+// delete as a single batch, with every shard paused so none change part way.
+func (s *Store) deleteWhere(who identity, prefix string, match func(DataValue) bool) (int, error) {
+	resume := s.pause()
+	defer resume()
+
+	view := &txnView{store: s, now: time.Now().UnixNano(), changed: make(map[string]*DataValue)}
+	changes := make(map[string]usage)
+
+	var records []walRecord
+
+	for _, sh := range s.shards {
+		for node := sh.keys.seek(prefix, nil); node != nil && strings.HasPrefix(node.key, prefix); node = node.next[0] {
+			current := sh.value[node.key]
+			if current.expired(view.now) || !match(current) || !current.allows(who, rightDelete) {
+				continue
+			}
+
+			view.set(node.key, nil)
+			addChange(changes, &current, nil)
+			records = append(records, walRecord{Op: walDelete, Key: node.key})
+		}
+	}
+
+	if err := s.commitBatch(records); err != nil {
+		return 0, err
+	}
+
+	s.quotas.apply(changes)
+	s.applyView(view, s.shards)
+
+	return len(records), nil
+}
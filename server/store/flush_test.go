@@ -0,0 +1,59 @@
+package store
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+func TestFlush(t *testing.T) {
+	s := openTestStore(t, Options{Depth: DefaultDepth, Quota: Quota{Keys: 2}})
+	defer s.Close()
+
+	<-s.Upsert("app/1", "user1", "value")
+	<-s.Upsert("app/2", "user2", "value")
+	<-s.Upsert("web/1", "user1", "value")
+
+	if _, err := s.Flush("user1", ""); err != ErrForbidden {
+		t.Errorf("Expected only admin to flush but got %v", err)
+	}
+
+	if count, err := s.Flush(admin, "app/"); err != nil || count != 2 {
+		t.Errorf("Expected the two keys with the prefix to be flushed but got %d, %v", count, err)
+	}
+
+	if list := <-s.List(admin); len(list) != 1 || list[0].Key != "web/1" {
+		t.Errorf("Expected only the key without the prefix to remain but got %v", list)
+	}
+
+	if count, err := s.Flush(admin, ""); err != nil || count != 1 || atomic.LoadInt64(&s.count) != 0 {
+		t.Errorf("Expected the rest of the store to be flushed but got %d, %v", count, err)
+	}
+
+	// the quota freed by the flush can be used again
+	<-s.Upsert("key1", "user1", "value")
+
+	if response := <-s.Upsert("key2", "user1", "value"); !stored(response) {
+		t.Errorf("Expected flushed keys to stop counting towards the quota but got %v", response)
+	}
+}
+
+func TestDeleteOwned(t *testing.T) {
+	s := openTestStore(t, Options{Depth: DefaultDepth})
+	defer s.Close()
+
+	_ = s.SetGroup(admin, "team", []string{"user1"})
+
+	<-s.Upsert("key1", "user1", "value")
+	<-s.Upsert("key2", "user1", "value")
+	<-s.Upsert("key3", "user2", "value")
+	<-s.UpsertWith(UpsertRequest{Key: "key4", Owner: "user1", Group: "team", Value: "value"})
+	<-s.GrantAccess("key3", "user2", "user1", Grant{Delete: true})
+
+	if count, err := s.DeleteOwned("user1"); err != nil || count != 2 {
+		t.Errorf("Expected only the keys user1 owns to be deleted but got %d, %v", count, err)
+	}
+
+	if list := <-s.List(admin); len(list) != 2 {
+		t.Errorf("Expected the granted and group keys to remain but got %v", list)
+	}
+}
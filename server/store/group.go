@@ -0,0 +1,140 @@
+package store
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// ErrBadGroup is a group that cannot be set up, such as one named after a
+// user.
+var ErrBadGroup = errors.New("bad group")
+
+// groups the named groups of users that may own keys, managed by admin.
+type groups struct {
+	mutex   sync.Mutex
+	members map[string]map[string]bool
+}
+
+func newGroups() *groups {
+	return &groups{members: make(map[string]map[string]bool)}
+}
+
+// identity a user along with the groups they belong to, any of which may own
+// or be granted a key.
+type identity struct {
+	user   string
+	groups map[string]bool
+}
+
+// is reports whether name is the user or one of their groups.
+func (i identity) is(name string) bool {
+	return name == i.user || i.groups[name]
+}
+
+// identify returns user's identity as the groups stand now.
+func (s *Store) identify(user string) identity {
+	s.groups.mutex.Lock()
+	defer s.groups.mutex.Unlock()
+
+	who := identity{user: user}
+
+	for name, members := range s.groups.members {
+		if members[user] {
+			if who.groups == nil {
+				who.groups = make(map[string]bool)
+			}
+
+			who.groups[name] = true
+		}
+	}
+
+	return who
+}
+
+// set replaces the members of a group, removing it if there are none.
+func (g *groups) set(name string, members []string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if len(members) == 0 {
+		delete(g.members, name)
+		return
+	}
+
+	set := make(map[string]bool, len(members))
+	for _, member := range members {
+		set[member] = true
+	}
+
+	g.members[name] = set
+}
+
+// copyMembers returns the members of every group in name order.
+func (g *groups) copyMembers() map[string][]string {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	copied := make(map[string][]string, len(g.members))
+
+	for name, members := range g.members {
+		list := make([]string, 0, len(members))
+		for member := range members {
+			list = append(list, member)
+		}
+
+		sort.Strings(list)
+		copied[name] = list
+	}
+
+	return copied
+}
+
+// SetGroup sets the members of the group name, removing the group if there
+// are none. Only admin may. Keys owned by a group that is removed can only
+// be changed by admin. Group names cannot be those of users.
+func (s *Store) SetGroup(caller, name string, members []string) error {
+	if caller != admin {
+		return ErrForbidden
+	}
+
+	if _, isUser := userList[name]; isUser || name == "" {
+		return ErrBadGroup
+	}
+
+	// pause so the change is ordered with snapshots and every transaction
+	// sees the group as it was before or after
+	resume := s.pause()
+	defer resume()
+
+	if err := s.commit(walRecord{Op: walGroup, Key: name, Members: members}); err != nil {
+		return err
+	}
+
+	s.groups.set(name, members)
+
+	return nil
+}
+
+// Groups returns the members of every group caller belongs to, every group
+// for admin.
+func (s *Store) Groups(caller string) map[string][]string {
+	all := s.groups.copyMembers()
+
+	if caller == admin {
+		return all
+	}
+
+	belongs := make(map[string][]string)
+
+	for name, members := range all {
+		for _, member := range members {
+			if member == caller {
+				belongs[name] = members
+				break
+			}
+		}
+	}
+
+	return belongs
+}
@@ -0,0 +1,71 @@
+package store
+
+import (
+	"testing"
+)
+
+func TestGroupOwnership(t *testing.T) {
+	dir := t.TempDir()
+
+	s := openTestStore(t, Options{Depth: DefaultDepth, DataDir: dir})
+
+	if err := s.SetGroup("user_a", "team", []string{"user_a"}); err != ErrForbidden {
+		t.Errorf("Expected only admin to set groups but got %v", err)
+	}
+
+	if err := s.SetGroup(admin, "user_b", []string{"user_a"}); err != ErrBadGroup {
+		t.Errorf("Expected a group named after a user to be refused but got %v", err)
+	}
+
+	if err := s.SetGroup(admin, "team", []string{"user_a", "user_b"}); err != nil {
+		t.Fatalf("Expected admin to set a group but got %v", err)
+	}
+
+	response := <-s.UpsertWith(UpsertRequest{Key: "key1", Owner: "user_c", Group: "team", Value: "value"})
+	if response != ErrForbidden {
+		t.Errorf("Expected a non-member not to create a key for the group but got %v", response)
+	}
+
+	response = <-s.UpsertWith(UpsertRequest{Key: "key1", Owner: "user_a", Group: "team", Value: "value"})
+	if value, ok := response.(DataValue); !ok || value.Owner != "team" {
+		t.Fatalf("Expected a member to create a key owned by the group but got %v", response)
+	}
+
+	s.Close()
+
+	s = openTestStore(t, Options{Depth: DefaultDepth, DataDir: dir})
+	defer s.Close()
+
+	if response = <-s.Upsert("key1", "user_b", "value2"); !stored(response) {
+		t.Errorf("Expected another member to update the key but got %v", response)
+	}
+
+	if response = <-s.Upsert("key1", "user_c", "value3"); response != ErrForbidden {
+		t.Errorf("Expected a non-member not to update the key but got %v", response)
+	}
+
+	if list := <-s.List("user_b"); len(list) != 1 || list[0].Owner != "team" {
+		t.Errorf("Expected the key to be listed as owned by the group but got %v", list)
+	}
+
+	if usage, err := s.Usage("user_b", "team"); err != nil || usage.Keys != 1 {
+		t.Errorf("Expected a member to see the group's usage but got %v, %v", usage, err)
+	}
+
+	<-s.Upsert("key2", "user_c", "value")
+	<-s.GrantAccess("key2", "user_c", "team", Grant{Read: true})
+
+	if _, ok := (<-s.FetchWith(FetchRequest{Key: "key2", Owner: "user_a"})).(DataValue); !ok {
+		t.Error("Expected a grant to the group to let its members read")
+	}
+
+	if groups := s.Groups("user_c"); len(groups) != 0 {
+		t.Errorf("Expected user_c to belong to no groups but got %v", groups)
+	}
+
+	_ = s.SetGroup(admin, "team", nil)
+
+	if response = <-s.Delete("key1", "user_a"); response != ErrForbidden {
+		t.Errorf("Expected a removed group's keys to be out of reach of its members but got %v", response)
+	}
+}
@@ -0,0 +1,201 @@
+package store
+
+// revisionOverhead approximates the memory taken by a revision beyond its
+// value.
+const revisionOverhead = 48
+
+// Revision a previous version of a key's value.
+type Revision struct {
+	Version         uint64 `json:"version"`
+	Value           string `json:"value"`
+	ContentType     string `json:"content_type,omitempty"`
+	ContentEncoding string `json:"content_encoding,omitempty"`
+	Writer          string `json:"writer"`
+	Modified        int64  `json:"modified"`
+}
+
+// VersionInfo describes a version of a key without its value, Current being
+// set for the version the key has now.
+type VersionInfo struct {
+	Version  uint64 `json:"version"`
+	Writer   string `json:"writer"`
+	Modified int64  `json:"modified"`
+	Size     int    `json:"size"`
+	Current  bool   `json:"current,omitempty"`
+}
+
+// HistoryRequest asks for the versions of a key Owner may read.
+type HistoryRequest struct {
+	Key      string
+	Owner    string
+	Response chan interface{}
+}
+
+// History lists the versions of key kept, oldest first, if owner may read
+// it. The response is a []VersionInfo or ErrNotFound.
+func (s *Store) History(key, owner string) chan interface{} {
+	responseChannel := make(chan interface{})
+	s.shardFor(key).historyChannel <- HistoryRequest{Key: key, Owner: owner, Response: responseChannel}
+
+	return responseChannel
+}
+
+// Restore makes an earlier version of key its current value, as a new
+// version written by owner. Only the owner or admin may. The response is the
+// stored DataValue or an error.
+func (s *Store) Restore(key, owner string, version uint64) chan interface{} {
+	return s.UpsertWith(UpsertRequest{Key: key, Owner: owner, Restore: version})
+}
+
+// keep is how many previous versions of value are kept.
+func (s *Store) keep(value DataValue) int {
+	if value.HistoryLimit != nil {
+		return *value.HistoryLimit
+	}
+
+	return s.history
+}
+
+// revised returns the value's history with the value itself added as the
+// newest revision, keeping no more than keep of them.
+func (d DataValue) revised(keep int) []Revision {
+	if keep <= 0 {
+		return nil
+	}
+
+	history := make([]Revision, 0, len(d.History)+1)
+	history = append(history, d.History...)
+	history = append(history, d.current())
+
+	if len(history) > keep {
+		history = history[len(history)-keep:]
+	}
+
+	return history
+}
+
+// revision returns the version of the value given, which may be the current
+// one.
+func (d DataValue) revision(version uint64) (Revision, bool) {
+	if version == d.Version {
+		return d.current(), true
+	}
+
+	for _, revision := range d.History {
+		if revision.Version == version {
+			return revision, true
+		}
+	}
+
+	return Revision{}, false
+}
+
+// current returns the value as it is now as a revision.
+func (d DataValue) current() Revision {
+	return Revision{
+		Version:         d.Version,
+		Value:           d.Value,
+		ContentType:     d.ContentType,
+		ContentEncoding: d.ContentEncoding,
+		Writer:          d.Writer,
+		Modified:        d.Modified,
+	}
+}
+
+// versionsOf returns the versions of history if d holds every revision in it,
+// as its history or itself, so it can be rebuilt from d by withVersions.
+func (d DataValue) versionsOf(history []Revision) ([]uint64, bool) {
+	versions := make([]uint64, 0, len(history))
+
+	for _, revision := range history {
+		if held, ok := d.revision(revision.Version); !ok || held != revision {
+			return nil, false
+		}
+
+		versions = append(versions, revision.Version)
+	}
+
+	return versions, true
+}
+
+// withVersions returns the revisions d holds with versions, in that order.
+func (d DataValue) withVersions(versions []uint64) []Revision {
+	history := make([]Revision, 0, len(versions))
+
+	for _, version := range versions {
+		if revision, ok := d.revision(version); ok {
+			history = append(history, revision)
+		}
+	}
+
+	return history
+}
+
+// logged returns record as it is written to the log, an upsert whose history
+// the key's previous value holds giving it by version. The shards the record
+// changes must be held.
+func (s *Store) logged(record walRecord) walRecord {
+	switch {
+	case record.Op == walBatch:
+		batch := make([]walRecord, len(record.Batch))
+		for i, change := range record.Batch {
+			batch[i] = s.logged(change)
+		}
+
+		record.Batch = batch
+	case record.Op == walUpsert && record.Entry != nil && len(record.Entry.History) > 0:
+		previous, ok := s.shardFor(record.Key).value[record.Key]
+		if !ok {
+			return record
+		}
+
+		if versions, held := previous.versionsOf(record.Entry.History); held {
+			entry := *record.Entry
+			entry.History = nil
+			record.Entry = &entry
+			record.Revisions = versions
+		}
+	}
+
+	return record
+}
+
+// historySize approximates the memory used by the value's history.
+func (d DataValue) historySize() int64 {
+	var size int64
+
+	for _, revision := range d.History {
+		size += int64(len(revision.Value) + revisionOverhead)
+	}
+
+	return size
+}
+
+func (sh *shard) transactionHistory(msg HistoryRequest) {
+	value, ok := sh.lookup(msg.Key)
+	if !ok || !value.allows(sh.store.identify(msg.Owner), rightRead) {
+		msg.Response <- ErrNotFound
+		return
+	}
+
+	versions := make([]VersionInfo, 0, len(value.History)+1)
+
+	for _, revision := range value.History {
+		versions = append(versions, VersionInfo{
+			Version:  revision.Version,
+			Writer:   revision.Writer,
+			Modified: revision.Modified,
+			Size:     len(revision.Value),
+		})
+	}
+
+	versions = append(versions, VersionInfo{
+		Version:  value.Version,
+		Writer:   value.Writer,
+		Modified: value.Modified,
+		Size:     len(value.Value),
+		Current:  true,
+	})
+
+	msg.Response <- versions
+}
@@ -0,0 +1,105 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	s := openTestStore(t, Options{Depth: DefaultDepth, History: 2})
+	defer s.Close()
+
+	var versions []uint64
+
+	for _, value := range []string{"one", "two", "three", "four"} {
+		stored, _ := (<-s.Upsert("key1", "user1", value)).(DataValue)
+		versions = append(versions, stored.Version)
+	}
+
+	history, _ := (<-s.History("key1", "user1")).([]VersionInfo)
+	if len(history) != 3 || history[0].Version != versions[1] || !history[2].Current || history[2].Writer != "user1" {
+		t.Fatalf("Expected two previous versions and the current one but got %v", history)
+	}
+
+	if response := <-s.History("key1", "user2"); response != ErrNotFound {
+		t.Errorf("Expected another user not to see the history but got %v", response)
+	}
+
+	value, ok := (<-s.FetchWith(FetchRequest{Key: "key1", Version: versions[2]})).(DataValue)
+	if !ok || value.Value != "three" {
+		t.Errorf("Expected to read an earlier version but got %v", value)
+	}
+
+	if response := <-s.FetchWith(FetchRequest{Key: "key1", Version: versions[0]}); response != nil {
+		t.Errorf("Expected a version no longer kept not to be found but got %v", response)
+	}
+
+	if response := <-s.Restore("key1", "user2", versions[1]); response != ErrForbidden {
+		t.Errorf("Expected only the owner to restore but got %v", response)
+	}
+
+	response := <-s.Restore("key1", "user1", versions[1])
+	if value, ok := response.(DataValue); !ok || value.Value != "two" || value.Version <= versions[3] {
+		t.Errorf("Expected restoring to write the earlier value as a new version but got %v", response)
+	}
+
+	limit := 0
+	<-s.UpsertWith(UpsertRequest{Key: "key1", Owner: "user1", Value: "five", HistoryLimit: &limit})
+
+	if history, _ = (<-s.History("key1", "user1")).([]VersionInfo); len(history) != 1 {
+		t.Errorf("Expected a per key limit of 0 to keep no history but got %v", history)
+	}
+}
+
+func TestHistoryInTransaction(t *testing.T) {
+	s := openTestStore(t, Options{Depth: DefaultDepth, History: 1})
+	defer s.Close()
+
+	first, _ := (<-s.Upsert("key1", "user1", "one")).(DataValue)
+
+	<-s.Transaction(TxnRequest{Owner: "user1", Operations: []TxnOperation{{Op: TxnPut, Key: "key1", Value: "two"}}})
+
+	value, ok := (<-s.FetchWith(FetchRequest{Key: "key1", Version: first.Version})).(DataValue)
+	if !ok || value.Value != "one" {
+		t.Errorf("Expected a transaction put to keep the previous version but got %v", value)
+	}
+}
+
+func TestHistoryLogged(t *testing.T) {
+	dir := t.TempDir()
+	value := strings.Repeat("v", 10000)
+
+	s := openTestStore(t, Options{Depth: DefaultDepth, DataDir: dir, History: 10})
+
+	for i := 0; i < 5; i++ {
+		<-s.Upsert("key1", "user1", value)
+	}
+
+	<-s.Transaction(TxnRequest{Owner: "user1", Operations: []TxnOperation{{Op: TxnPut, Key: "key1", Value: value}}})
+	<-s.Pin("key1", "user1", true)
+
+	before, _ := (<-s.History("key1", "user1")).([]VersionInfo)
+
+	// each write logs its value once, not again for every revision kept
+	if info, err := os.Stat(filepath.Join(dir, walFileName)); err != nil || info.Size() > int64(8*len(value)) {
+		t.Errorf("Expected about one value logged for each write but got %v, %v", info.Size(), err)
+	}
+
+	if retained := atomic.LoadInt64(&s.versions.retained); retained > int64(8*len(value)) {
+		t.Errorf("Expected about one value retained for each past version but got %d", retained)
+	}
+
+	s.Close()
+
+	s = openTestStore(t, Options{Depth: DefaultDepth, DataDir: dir, History: 10})
+	defer s.Close()
+
+	after, _ := (<-s.History("key1", "user1")).([]VersionInfo)
+	if len(after) != 6 || !reflect.DeepEqual(before, after) {
+		t.Errorf("Expected the history to be replayed as it was, %v, but got %v", before, after)
+	}
+}
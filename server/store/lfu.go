@@ -0,0 +1,97 @@
+package store
+
+import "container/list"
+
+// lfuBucket holds the keys used the same number of times, least recently
+// used at the back.
+type lfuBucket struct {
+	count int
+	keys  *list.List
+}
+
+// lfuEntry is where a key sits in the policy.
+type lfuEntry struct {
+	bucket  *list.Element
+	element *list.Element
+}
+
+// lfuPolicy evicts the least frequently used key, the least recently used of
+// those if there is a tie. Buckets are kept in ascending order of use so
+// every operation takes constant time.
+type lfuPolicy struct {
+	buckets *list.List
+	entries map[string]lfuEntry
+}
+
+func newLFUPolicy() *lfuPolicy {
+	return &lfuPolicy{buckets: list.New(), entries: make(map[string]lfuEntry)}
+}
+
+func (l *lfuPolicy) Inserted(key string) {
+	if _, ok := l.entries[key]; ok {
+		l.Accessed(key)
+		return
+	}
+
+	front := l.buckets.Front()
+	if front == nil || bucketOf(front).count != 1 {
+		front = l.buckets.PushFront(&lfuBucket{count: 1, keys: list.New()})
+	}
+
+	l.entries[key] = lfuEntry{bucket: front, element: bucketOf(front).keys.PushFront(key)}
+}
+
+// Accessed moves key up to the bucket for one more use.
+func (l *lfuPolicy) Accessed(key string) {
+	entry, ok := l.entries[key]
+	if !ok {
+		return
+	}
+
+	current := bucketOf(entry.bucket)
+
+	next := entry.bucket.Next()
+	if next == nil || bucketOf(next).count != current.count+1 {
+		next = l.buckets.InsertAfter(&lfuBucket{count: current.count + 1, keys: list.New()}, entry.bucket)
+	}
+
+	l.unlink(entry)
+	l.entries[key] = lfuEntry{bucket: next, element: bucketOf(next).keys.PushFront(key)}
+}
+
+func (l *lfuPolicy) Removed(key string) {
+	if entry, ok := l.entries[key]; ok {
+		l.unlink(entry)
+		delete(l.entries, key)
+	}
+}
+
+func (l *lfuPolicy) Evicted(key string) {
+	l.Removed(key)
+}
+
+func (l *lfuPolicy) Victim() (string, bool) {
+	front := l.buckets.Front()
+	if front == nil {
+		return "", false
+	}
+
+	key, _ := bucketOf(front).keys.Back().Value.(string)
+
+	return key, true
+}
+
+// unlink takes an entry out of its bucket, dropping the bucket once empty.
+func (l *lfuPolicy) unlink(entry lfuEntry) {
+	bucket := bucketOf(entry.bucket)
+	bucket.keys.Remove(entry.element)
+
+	if bucket.keys.Len() == 0 {
+		l.buckets.Remove(entry.bucket)
+	}
+}
+
+func bucketOf(element *list.Element) *lfuBucket {
+	bucket, _ := element.Value.(*lfuBucket)
+	return bucket
+}
@@ -0,0 +1,68 @@
+package store
+
+import "container/list"
+
+// lruPolicy keeps keys ordered by when they were last used so the least
+// recently used key can be found without scanning the store.
+type lruPolicy struct {
+	order    *list.List
+	elements map[string]*list.Element
+}
+
+func newLRUPolicy() *lruPolicy {
+	return &lruPolicy{
+		order:    list.New(),
+		elements: make(map[string]*list.Element),
+	}
+}
+
+// Inserted marks key as the most recently used, adding it if not present.
+func (l *lruPolicy) Inserted(key string) {
+	if element, ok := l.elements[key]; ok {
+		l.order.MoveToFront(element)
+		return
+	}
+
+	l.elements[key] = l.order.PushFront(key)
+}
+
+// Accessed marks key as the most recently used.
+func (l *lruPolicy) Accessed(key string) {
+	if element, ok := l.elements[key]; ok {
+		l.order.MoveToFront(element)
+	}
+}
+
+// Removed drops key from the order.
+func (l *lruPolicy) Removed(key string) {
+	if element, ok := l.elements[key]; ok {
+		l.order.Remove(element)
+		delete(l.elements, key)
+	}
+}
+
+// Evicted drops key from the order.
+func (l *lruPolicy) Evicted(key string) {
+	l.Removed(key)
+}
+
+// Victim returns the least recently used key, false if there are none.
+func (l *lruPolicy) Victim() (string, bool) {
+	element := l.order.Back()
+	if element == nil {
+		return "", false
+	}
+
+	key, _ := element.Value.(string)
+
+	return key, true
+}
+
+func (l *lruPolicy) has(key string) bool {
+	_, ok := l.elements[key]
+	return ok
+}
+
+func (l *lruPolicy) len() int {
+	return l.order.Len()
+}
@@ -0,0 +1,106 @@
+package store
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLRUPolicy(t *testing.T) {
+	index := newLRUPolicy()
+
+	if _, ok := index.Victim(); ok {
+		t.Error("Expected no oldest key for an empty index")
+	}
+
+	index.Inserted("a")
+	index.Inserted("b")
+	index.Inserted("c")
+	index.Accessed("a")
+	index.Removed("b")
+
+	if key, _ := index.Victim(); key != "c" {
+		t.Errorf("Expected oldest key to be c but got %s", key)
+	}
+
+	index.Evicted("c")
+
+	if key, _ := index.Victim(); key != "a" {
+		t.Errorf("Expected oldest key to be a but got %s", key)
+	}
+}
+
+// scanOldest is the eviction scan the store used before the LRU index, kept
+// to benchmark against.
+func scanOldest(m map[string]DataValue) string {
+	var oldestKey string
+
+	now := time.Now().UnixNano()
+
+	for k, v := range m {
+		if v.Timestamp < now {
+			oldestKey = k
+			now = v.Timestamp
+		}
+	}
+
+	return oldestKey
+}
+
+var benchmarkDepths = []int{10_000, 1_000_000}
+
+// BenchmarkEviction measures finding and replacing the least recently used key
+// in a full store.
+func BenchmarkEviction(b *testing.B) {
+	for _, depth := range benchmarkDepths {
+		values := make(map[string]DataValue, depth)
+		index := newLRUPolicy()
+
+		for i := 0; i < depth; i++ {
+			key := strconv.Itoa(i)
+			values[key] = DataValue{Timestamp: time.Now().UnixNano()}
+			index.Inserted(key)
+		}
+
+		b.Run(fmt.Sprintf("scan/depth=%d", depth), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				oldest := scanOldest(values)
+				delete(values, oldest)
+				values[oldest] = DataValue{Timestamp: time.Now().UnixNano()}
+			}
+		})
+
+		b.Run(fmt.Sprintf("index/depth=%d", depth), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				oldest, _ := index.Victim()
+				index.Evicted(oldest)
+				index.Inserted(oldest)
+			}
+		})
+	}
+}
+
+// BenchmarkUpsertFullStore measures inserting new keys into a full store.
+func BenchmarkUpsertFullStore(b *testing.B) {
+	for _, depth := range benchmarkDepths {
+		b.Run(fmt.Sprintf("depth=%d", depth), func(b *testing.B) {
+			s, err := New(Options{Depth: depth})
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			defer s.Close()
+
+			for i := 0; i < depth; i++ {
+				<-s.Upsert(strconv.Itoa(i), "user", "value")
+			}
+
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				<-s.Upsert("new"+strconv.Itoa(i), "user", "value")
+			}
+		})
+	}
+}
@@ -0,0 +1,361 @@
+package store
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultRetention how long versions are kept for reads as of an earlier time
+// when none is given.
+const DefaultRetention = time.Minute
+
+// minCollectInterval stops a short retention collecting continually.
+const minCollectInterval = 100 * time.Millisecond
+
+// ErrTooOld is a read as of a time before the retention window, or before
+// versions were collected early to stay within the memory budget.
+var ErrTooOld = errors.New("too old")
+
+// mvccVersion a committed version of a key, its value being nil once the key
+// was deleted. The value is kept without its history, which the key's
+// current value holds. At is when it was committed in unix nanoseconds and size the
+// memory its value uses. Versions are linked newest first, a version never
+// changing once published other than the collector cutting off those before
+// it.
+type mvccVersion struct {
+	seq   uint64
+	at    int64
+	value *DataValue
+	size  int64
+	prev  atomic.Pointer[mvccVersion]
+}
+
+// mvccChain the versions of a key, head being the newest. A commit adds a
+// version in front of the head without copying those before it.
+type mvccChain struct {
+	head atomic.Pointer[mvccVersion]
+}
+
+// mvcc keeps the committed versions of every key so reads can see the whole
+// store at a single point, now or in the retention window, without waiting on
+// the shards or holding up writes. Versions are published in commit order,
+// those after seq are not yet visible. Reads as of before floor are refused,
+// the versions they need having been collected. Retained is the memory used
+// by versions kept only for reads of the past, which counts against the
+// store's memory budget.
+type mvcc struct {
+	chains    sync.Map
+	mutex     sync.Mutex
+	seq       uint64
+	last      int64
+	floor     int64
+	retained  int64
+	retention time.Duration
+	pressure  chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+func newMVCC(retention time.Duration) *mvcc {
+	if retention <= 0 {
+		retention = DefaultRetention
+	}
+
+	return &mvcc{
+		retention: retention,
+		pressure:  make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// publish adds the versions records commit, making them visible together. It
+// is only called with the store's commitMutex held so versions are added in
+// sequence order, and their times never go backwards.
+func (m *mvcc) publish(records ...walRecord) {
+	at := time.Now().UnixNano()
+	if at < m.last {
+		at = m.last
+	}
+
+	m.last = at
+
+	var seq uint64
+
+	m.mutex.Lock()
+
+	for _, record := range records {
+		switch {
+		case record.Op == walUpsert && record.Entry != nil:
+			value := *record.Entry
+			value.History = nil
+			m.add(record.Key, &mvccVersion{seq: record.Seq, at: at, value: &value, size: entrySize(record.Key, value)})
+		case record.Op == walDelete:
+			m.add(record.Key, &mvccVersion{seq: record.Seq, at: at})
+		}
+
+		seq = record.Seq
+	}
+
+	m.mutex.Unlock()
+
+	atomic.StoreUint64(&m.seq, seq)
+}
+
+// add puts a version in front of the chain for key, the version it
+// supersedes now only being kept for reads of the past. The mutex must be
+// held so the collector cannot drop the chain meanwhile.
+func (m *mvcc) add(key string, version *mvccVersion) {
+	loaded, ok := m.chains.Load(key)
+	if !ok {
+		loaded, _ = m.chains.LoadOrStore(key, &mvccChain{})
+	}
+
+	chain, _ := loaded.(*mvccChain)
+
+	previous := chain.head.Load()
+	if previous != nil && previous.value != nil {
+		atomic.AddInt64(&m.retained, previous.size)
+	}
+
+	version.prev.Store(previous)
+	chain.head.Store(version)
+}
+
+// load records the values the store was restored with as their only
+// versions, seq being the last change they include. The versions they
+// superseded were not kept, so reads as of before now are refused rather
+// than missing them.
+func (m *mvcc) load(shards []*shard, seq uint64) {
+	for _, sh := range shards {
+		for key, value := range sh.value {
+			value := value
+			value.History = nil
+			chain := &mvccChain{}
+			chain.head.Store(&mvccVersion{
+				seq:   value.Version,
+				at:    value.Modified,
+				value: &value,
+				size:  entrySize(key, value),
+			})
+			m.chains.Store(key, chain)
+		}
+	}
+
+	m.seq = seq
+	m.floor = time.Now().UnixNano()
+}
+
+// collected reports whether versions a read as of at, in unix nanoseconds,
+// needs may have been collected. Checked again once a read is done it
+// catches the collector having run meanwhile.
+func (m *mvcc) collected(at int64) bool {
+	return at < atomic.LoadInt64(&m.floor)
+}
+
+// view returns a function reading a key's chain as it was when the last
+// version now published was committed, and at time at in unix nanoseconds,
+// nil if the key did not exist. ErrTooOld is returned if at is before the
+// retention window or the versions it needs have been collected.
+func (m *mvcc) view(at int64) (func(chain *mvccChain) *DataValue, error) {
+	if at < time.Now().Add(-m.retention).UnixNano() || m.collected(at) {
+		return nil, ErrTooOld
+	}
+
+	seq := atomic.LoadUint64(&m.seq)
+
+	return func(chain *mvccChain) *DataValue {
+		for version := chain.head.Load(); version != nil; version = version.prev.Load() {
+			if version.seq <= seq && version.at <= at {
+				if version.value == nil || version.value.expired(at) {
+					return nil
+				}
+
+				return version.value
+			}
+		}
+
+		return nil
+	}, nil
+}
+
+// collect drops the versions no read from horizon on, in unix nanoseconds,
+// can see: those superseded by a version committed before it, and keys
+// deleted before it. Reads as of before the horizon are refused from now on.
+func (m *mvcc) collect(horizon int64) {
+	for floor := atomic.LoadInt64(&m.floor); floor < horizon; floor = atomic.LoadInt64(&m.floor) {
+		if atomic.CompareAndSwapInt64(&m.floor, floor, horizon) {
+			break
+		}
+	}
+
+	m.chains.Range(func(key, loaded interface{}) bool {
+		chain, _ := loaded.(*mvccChain)
+
+		// the newest version at or before the horizon is the oldest needed
+		kept := chain.head.Load()
+		for kept != nil && kept.at > horizon {
+			kept = kept.prev.Load()
+		}
+
+		if kept == nil {
+			return true
+		}
+
+		for dropped := kept.prev.Swap(nil); dropped != nil; dropped = dropped.prev.Load() {
+			if dropped.value != nil {
+				atomic.AddInt64(&m.retained, -dropped.size)
+			}
+		}
+
+		if kept.value == nil {
+			m.mutex.Lock()
+			if chain.head.Load() == kept {
+				m.chains.Delete(key)
+			}
+			m.mutex.Unlock()
+		}
+
+		return true
+	})
+}
+
+// squeeze asks the collector to drop every version kept only for reads of
+// the past, without waiting for it to.
+func (m *mvcc) squeeze() {
+	select {
+	case m.pressure <- struct{}{}:
+	default:
+	}
+}
+
+// collectEvery collects old versions every half of the retention window, or
+// every version kept only for reads of the past when squeezed, until
+// stopped.
+func (m *mvcc) collectEvery() {
+	defer close(m.done)
+
+	interval := m.retention / 2
+	if interval < minCollectInterval {
+		interval = minCollectInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.collect(time.Now().Add(-m.retention).UnixNano())
+		case <-m.pressure:
+			m.collect(time.Now().UnixNano())
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// FetchAt gets key as owner could have read it at, in unix nanoseconds,
+// within the retention window. Unlike Fetch it neither waits on the shard nor
+// counts as a read, the counters being those the key had when last written,
+// and the value has no history.
+func (s *Store) FetchAt(key, owner string, at int64) (DataValue, error) {
+	read, err := s.versions.view(at)
+	if err != nil {
+		return DataValue{}, err
+	}
+
+	var value *DataValue
+
+	if loaded, ok := s.versions.chains.Load(key); ok {
+		chain, _ := loaded.(*mvccChain)
+		value = read(chain)
+	}
+
+	if s.versions.collected(at) {
+		return DataValue{}, ErrTooOld
+	}
+
+	if value == nil || !value.allows(s.identify(owner), rightRead) {
+		return DataValue{}, ErrNotFound
+	}
+
+	return *value, nil
+}
+
+// ListAt lists every key owner could have seen at, in unix nanoseconds, in
+// order, or just key if it is set, from a single consistent point in the
+// store. Writes carry on while the list is built. As with FetchAt the
+// counters are those each key had when last written.
+func (s *Store) ListAt(key, owner string, at int64) ([]ListValue, error) {
+	if key == "" {
+		page, err := s.ScanAt(owner, at, KeyRange{})
+		return page.Keys, err
+	}
+
+	read, err := s.versions.view(at)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []ListValue
+
+	if loaded, ok := s.versions.chains.Load(key); ok {
+		chain, _ := loaded.(*mvccChain)
+		if value := read(chain); value != nil && value.listable(s.identify(owner)) {
+			list = append(list, listValue(key, *value, s.identify(owner), at))
+		}
+	}
+
+	if s.versions.collected(at) {
+		return nil, ErrTooOld
+	}
+
+	return list, nil
+}
+
+// ScanAt lists the keys in r owner could have seen at, in unix nanoseconds,
+// in order, as Scan does for now but from a single consistent point in the
+// store. Paging on from Next with the same at carries on through the same
+// point in the store, so the pages together are consistent too.
+func (s *Store) ScanAt(owner string, at int64, r KeyRange) (ListPage, error) {
+	read, err := s.versions.view(at)
+	if err != nil {
+		return ListPage{}, err
+	}
+
+	who := s.identify(owner)
+	from := r.from()
+
+	var page ListPage
+
+	s.versions.chains.Range(func(loadedKey, loaded interface{}) bool {
+		name, _ := loadedKey.(string)
+		if name < from || r.past(name) || name == r.After {
+			return true
+		}
+
+		chain, _ := loaded.(*mvccChain)
+		if value := read(chain); value != nil && value.listable(who) {
+			page.Keys = append(page.Keys, listValue(name, *value, who, at))
+		}
+
+		return true
+	})
+
+	if s.versions.collected(at) {
+		return ListPage{}, ErrTooOld
+	}
+
+	sort.Slice(page.Keys, func(i, j int) bool { return page.Keys[i].Key < page.Keys[j].Key })
+
+	if r.Limit > 0 && len(page.Keys) > r.Limit {
+		page.Keys = page.Keys[:r.Limit]
+		page.Next = page.Keys[r.Limit-1].Key
+	}
+
+	return page, nil
+}
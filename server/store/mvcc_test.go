@@ -0,0 +1,234 @@
+package store
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFetchAt(t *testing.T) {
+	s := openTestStore(t, Options{Depth: DefaultDepth, Retention: time.Hour})
+	defer s.Close()
+
+	before := time.Now().UnixNano()
+
+	<-s.Upsert("key1", "user1", "one")
+
+	between := time.Now().UnixNano()
+
+	<-s.Upsert("key1", "user1", "two")
+	<-s.Delete("key1", "user1")
+
+	if _, err := s.FetchAt("key1", "user1", before); err != ErrNotFound {
+		t.Errorf("Expected the key not to exist before it was written but got %v", err)
+	}
+
+	if value, err := s.FetchAt("key1", "user1", between); err != nil || value.Value != "one" {
+		t.Errorf("Expected the first value as of between the writes but got %v, %v", value, err)
+	}
+
+	if _, err := s.FetchAt("key1", "user2", between); err != ErrNotFound {
+		t.Errorf("Expected another user not to read the past value but got %v", err)
+	}
+
+	if _, err := s.FetchAt("key1", "user1", time.Now().UnixNano()); err != ErrNotFound {
+		t.Errorf("Expected the key to be deleted now but got %v", err)
+	}
+
+	if _, err := s.FetchAt("key1", "user1", time.Now().Add(-2*time.Hour).UnixNano()); err != ErrTooOld {
+		t.Errorf("Expected a read before the retention window to be too old but got %v", err)
+	}
+}
+
+func TestListAtIsConsistent(t *testing.T) {
+	s := openTestStore(t, Options{Depth: 1000, Shards: 4})
+	defer s.Close()
+
+	// pairs of keys are always written together so a consistent list always
+	// has both or neither
+	var wg sync.WaitGroup
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			for j := 0; j < 50; j++ {
+				<-s.Transaction(TxnRequest{Owner: "user1", Operations: []TxnOperation{
+					{Op: TxnPut, Key: fmt.Sprintf("a%d-%d", i, j), Value: "value"},
+					{Op: TxnPut, Key: fmt.Sprintf("b%d-%d", i, j), Value: "value"},
+				}})
+			}
+		}(i)
+	}
+
+	for k := 0; k < 20; k++ {
+		list, err := s.ListAt("", "user1", time.Now().UnixNano())
+		if err != nil || len(list)%2 != 0 {
+			t.Fatalf("Expected a list with both keys of every pair but got %d keys, %v", len(list), err)
+		}
+	}
+
+	wg.Wait()
+
+	if list, _ := s.ListAt("", "user1", time.Now().UnixNano()); len(list) != 400 {
+		t.Errorf("Expected every key to be listed but got %d", len(list))
+	}
+}
+
+func TestCollectVersions(t *testing.T) {
+	s := openTestStore(t, Options{Depth: DefaultDepth, Retention: time.Hour})
+	defer s.Close()
+
+	<-s.Upsert("key1", "user1", "one")
+	<-s.Upsert("key1", "user1", "two")
+	<-s.Upsert("key2", "user1", "value")
+	<-s.Delete("key2", "user1")
+
+	// collect as if the retention window has passed
+	s.versions.collect(time.Now().UnixNano())
+
+	if loaded, ok := s.versions.chains.Load("key1"); !ok || loaded.(*mvccChain).head.Load().prev.Load() != nil {
+		t.Errorf("Expected only the current version of key1 to be kept but got %v", loaded)
+	}
+
+	if retained := atomic.LoadInt64(&s.versions.retained); retained != 0 {
+		t.Errorf("Expected no memory to be retained for past reads but got %d", retained)
+	}
+
+	if _, err := s.FetchAt("key1", "user1", time.Now().Add(-time.Minute).UnixNano()); err != ErrTooOld {
+		t.Errorf("Expected a read from before the collection to be too old but got %v", err)
+	}
+
+	if _, ok := s.versions.chains.Load("key2"); ok {
+		t.Error("Expected a deleted key to be dropped")
+	}
+
+	if value, err := s.FetchAt("key1", "user1", time.Now().UnixNano()); err != nil || value.Value != "two" {
+		t.Errorf("Expected the current value to survive collection but got %v, %v", value, err)
+	}
+}
+
+func TestHotKeyVersions(t *testing.T) {
+	s := openTestStore(t, Options{Depth: DefaultDepth, Retention: time.Hour})
+	defer s.Close()
+
+	<-s.Upsert("key1", "user1", "first")
+
+	loaded, _ := s.versions.chains.Load("key1")
+	first := loaded.(*mvccChain).head.Load()
+
+	for i := 0; i < 1000; i++ {
+		<-s.Upsert("key1", "user1", "value")
+	}
+
+	// each write links in front of the last, never copying the chain
+	versions := 0
+	oldest := loaded.(*mvccChain).head.Load()
+
+	for version := oldest; version != nil; version = version.prev.Load() {
+		versions++
+		oldest = version
+	}
+
+	if versions != 1001 || oldest != first {
+		t.Errorf("Expected 1001 versions ending at the first but got %d", versions)
+	}
+
+	want := 1000 * entrySize("key1", DataValue{Value: "value"})
+	if retained := atomic.LoadInt64(&s.versions.retained); retained < want {
+		t.Errorf("Expected at least %d bytes retained for past reads but got %d", want, retained)
+	}
+}
+
+func TestRetainedVersionsCountAgainstBudget(t *testing.T) {
+	s := openTestStore(t, Options{Depth: DefaultDepth, Retention: time.Hour, MaxBytes: 4096})
+	defer s.Close()
+
+	for i := 0; i < 100; i++ {
+		<-s.Upsert(fmt.Sprintf("key%d", i%5), "user1", "a value kept for reads of the past")
+		<-s.Delete(fmt.Sprintf("key%d", i%5), "user1")
+	}
+
+	// the collector is woken once the deleted versions take the store over
+	// budget, dropping them
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt64(&s.versions.retained) > 4096 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if retained := atomic.LoadInt64(&s.versions.retained); retained > 4096 {
+		t.Errorf("Expected retained versions to be collected within budget but %d bytes are kept", retained)
+	}
+}
+
+func TestScanAt(t *testing.T) {
+	s := openTestStore(t, Options{Depth: DefaultDepth, Shards: 4, Retention: time.Hour})
+	defer s.Close()
+
+	for _, key := range []string{"d", "b", "e", "a", "c", "f"} {
+		<-s.Upsert(key, "user1", "value")
+	}
+
+	at := time.Now().UnixNano()
+
+	<-s.Delete("c", "user1")
+	<-s.Upsert("bb", "user1", "value")
+
+	var keys []string
+
+	r := KeyRange{Limit: 2}
+
+	for {
+		page, err := s.ScanAt("user1", at, r)
+		if err != nil {
+			t.Fatalf("Expected a page but got %v", err)
+		}
+
+		for _, value := range page.Keys {
+			keys = append(keys, value.Key)
+		}
+
+		if page.Next == "" {
+			break
+		}
+
+		r.After = page.Next
+	}
+
+	if got := fmt.Sprint(keys); got != "[a b c d e f]" {
+		t.Errorf("Expected the keys as of before the changes in order but got %s", got)
+	}
+
+	page, err := s.ScanAt("user1", time.Now().UnixNano(), KeyRange{Prefix: "b"})
+	if err != nil || len(page.Keys) != 2 || page.Next != "" {
+		t.Errorf("Expected both keys with the prefix now but got %v, %v", page, err)
+	}
+}
+
+func TestFetchAtAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	s := openTestStore(t, Options{Depth: DefaultDepth, DataDir: dir, Retention: time.Hour})
+	<-s.Upsert("key1", "user1", "one")
+
+	between := time.Now().UnixNano()
+
+	<-s.Upsert("key1", "user1", "two")
+	s.Close()
+
+	s = openTestStore(t, Options{Depth: DefaultDepth, DataDir: dir, Retention: time.Hour})
+	defer s.Close()
+
+	// the first value was not kept through the restart
+	if value, err := s.FetchAt("key1", "user1", between); err != ErrTooOld {
+		t.Errorf("Expected a read from before the restart to be too old but got %v, %v", value, err)
+	}
+
+	if value, err := s.FetchAt("key1", "user1", time.Now().UnixNano()); err != nil || value.Value != "two" {
+		t.Errorf("Expected the value restored to be read now but got %v, %v", value, err)
+	}
+}
@@ -0,0 +1,84 @@
+package store
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// DefaultPinnedFraction of the depth that may be pinned when none is given.
+const DefaultPinnedFraction = 0.5
+
+// ErrPinLimit is a pin that would take the store over its pinned key limit.
+var ErrPinLimit = errors.New("too many pinned keys")
+
+// PinRequest pins or unpins a key, pinned keys are never evicted.
+type PinRequest struct {
+	Key      string
+	Owner    string
+	Pinned   bool
+	Response chan interface{}
+}
+
+// Pin pins or unpins key, only its owner or admin may. The response is the
+// updated DataValue or an error.
+func (s *Store) Pin(key, owner string, pinned bool) chan interface{} {
+	responseChannel := make(chan interface{})
+	s.shardFor(key).pinChannel <- PinRequest{Key: key, Owner: owner, Pinned: pinned, Response: responseChannel}
+
+	return responseChannel
+}
+
+func (sh *shard) transactionPin(msg PinRequest) {
+	value, ok := sh.lookup(msg.Key)
+
+	switch {
+	case !ok:
+		msg.Response <- ErrNotFound
+		return
+	case !value.manages(sh.store.identify(msg.Owner)):
+		msg.Response <- ErrForbidden
+		return
+	case value.Pinned == msg.Pinned:
+		msg.Response <- value
+		return
+	}
+
+	if msg.Pinned && !sh.store.reservePin() {
+		msg.Response <- ErrPinLimit
+		return
+	}
+
+	value.Pinned = msg.Pinned
+
+	if err := sh.put(msg.Key, &value); err != nil {
+		if msg.Pinned {
+			atomic.AddInt64(&sh.store.pinned, -1)
+		}
+
+		msg.Response <- err
+
+		return
+	}
+
+	if !msg.Pinned {
+		atomic.AddInt64(&sh.store.pinned, -1)
+	}
+
+	msg.Response <- value
+}
+
+// reservePin claims one of the pinned keys allowed, false if they are all in
+// use.
+func (s *Store) reservePin() bool {
+	for {
+		pinned := atomic.LoadInt64(&s.pinned)
+
+		if pinned >= s.maxPinned {
+			return false
+		}
+
+		if atomic.CompareAndSwapInt64(&s.pinned, pinned, pinned+1) {
+			return true
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package store
+
+import (
+	"testing"
+)
+
+func TestPinSkipsEviction(t *testing.T) {
+	s := openTestStore(t, Options{Depth: 3})
+	defer s.Close()
+
+	<-s.Upsert("key1", "user1", "value")
+
+	if response := <-s.Pin("key1", "user1", true); !isPinned(response) {
+		t.Fatalf("Expected key1 to be pinned but got %v", response)
+	}
+
+	for _, key := range []string{"key2", "key3", "key4", "key5"} {
+		<-s.Upsert(key, "user1", "value")
+	}
+
+	if _, ok := (<-s.Fetch("key1")).(DataValue); !ok {
+		t.Error("Expected a pinned key to survive eviction")
+	}
+
+	if response := <-s.Fetch("key2"); response != nil {
+		t.Errorf("Expected the oldest unpinned key to be evicted but got %v", response)
+	}
+
+	if list := <-s.ListForKey("key1", "user1"); len(list) != 1 || !list[0].Pinned {
+		t.Errorf("Expected list to show key1 pinned but got %v", list)
+	}
+
+	// updating keeps the pin
+	<-s.Upsert("key1", "user1", "value2")
+	<-s.Pin("key1", "user1", false)
+
+	// unpinning counts as a use, so the other keys go first
+	for _, key := range []string{"key6", "key7", "key8"} {
+		<-s.Upsert(key, "user1", "value")
+	}
+
+	if response := <-s.Fetch("key1"); response != nil {
+		t.Errorf("Expected an unpinned key to be evicted again but got %v", response)
+	}
+}
+
+func TestPinOwnership(t *testing.T) {
+	s := openTestStore(t, Options{Depth: DefaultDepth})
+	defer s.Close()
+
+	<-s.Upsert("key1", "user1", "value")
+
+	if response := <-s.Pin("key1", "user2", true); response != ErrForbidden {
+		t.Errorf("Expected pinning another user's key to be forbidden but got %v", response)
+	}
+
+	if response := <-s.Pin("missing", "user1", true); response != ErrNotFound {
+		t.Errorf("Expected pinning a missing key to be not found but got %v", response)
+	}
+
+	if response := <-s.Pin("key1", admin, true); !isPinned(response) {
+		t.Errorf("Expected admin to pin any key but got %v", response)
+	}
+}
+
+func TestPinLimit(t *testing.T) {
+	s := openTestStore(t, Options{Depth: 4, PinnedFraction: 0.5})
+	defer s.Close()
+
+	for _, key := range []string{"key1", "key2", "key3"} {
+		<-s.Upsert(key, "user1", "value")
+	}
+
+	<-s.Pin("key1", "user1", true)
+	<-s.Pin("key2", "user1", true)
+
+	if response := <-s.Pin("key3", "user1", true); response != ErrPinLimit {
+		t.Errorf("Expected pinning past the limit to fail but got %v", response)
+	}
+
+	<-s.Delete("key2", "user1")
+
+	if response := <-s.Pin("key3", "user1", true); !isPinned(response) {
+		t.Errorf("Expected deleting a pinned key to free its place but got %v", response)
+	}
+}
+
+func TestPinRestore(t *testing.T) {
+	dir := t.TempDir()
+
+	s := openTestStore(t, Options{Depth: DefaultDepth, DataDir: dir})
+	<-s.Upsert("key1", "user1", "value")
+	<-s.Pin("key1", "user1", true)
+	s.Close()
+
+	s = openTestStore(t, Options{Depth: DefaultDepth, DataDir: dir})
+	defer s.Close()
+
+	if value, ok := (<-s.Fetch("key1")).(DataValue); !ok || !value.Pinned || s.pinned != 1 {
+		t.Errorf("Expected key1 to be restored pinned but got %v with %d pinned", value, s.pinned)
+	}
+}
+
+func isPinned(response interface{}) bool {
+	value, ok := response.(DataValue)
+	return ok && value.Pinned
+}
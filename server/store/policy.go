@@ -0,0 +1,110 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Policy decides which key a shard evicts when it is full. A shard tells its
+// policy about every key it stores, uses and removes, then asks it for a
+// victim when it needs room.
+type Policy interface {
+	// Inserted records a key new to the shard.
+	Inserted(key string)
+	// Accessed records a read or update of a key, ignoring keys it does not
+	// hold.
+	Accessed(key string)
+	// Removed forgets a key that has been deleted or pinned.
+	Removed(key string)
+	// Evicted forgets a key that has been evicted after being chosen by Victim.
+	Evicted(key string)
+	// Victim returns the key to evict next, false if there are none.
+	Victim() (string, bool)
+}
+
+// NewPolicy creates the policy for a shard holding up to capacity keys.
+type NewPolicy func(capacity int) Policy
+
+// ErrPolicy is an unknown eviction policy name.
+var ErrPolicy = errors.New("unknown eviction policy")
+
+// ParsePolicy converts lru, lfu, fifo, random or arc to the function creating
+// that policy.
+func ParsePolicy(name string) (NewPolicy, error) {
+	switch name {
+	case "lru":
+		return func(int) Policy { return newLRUPolicy() }, nil
+	case "lfu":
+		return func(int) Policy { return newLFUPolicy() }, nil
+	case "fifo":
+		return func(int) Policy { return newFIFOPolicy() }, nil
+	case "random":
+		return func(int) Policy { return newRandomPolicy(rand.NewSource(time.Now().UnixNano())) }, nil
+	case "arc":
+		return func(capacity int) Policy { return newARCPolicy(capacity) }, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrPolicy, name)
+}
+
+// fifoPolicy evicts keys in the order they were inserted, however much they
+// have been used since.
+type fifoPolicy struct {
+	*lruPolicy
+}
+
+func newFIFOPolicy() fifoPolicy {
+	return fifoPolicy{newLRUPolicy()}
+}
+
+// Accessed leaves the key where it is.
+func (fifoPolicy) Accessed(string) {}
+
+// randomPolicy evicts any key with equal chance.
+type randomPolicy struct {
+	keys    []string
+	indexes map[string]int
+	random  *rand.Rand
+}
+
+func newRandomPolicy(source rand.Source) *randomPolicy {
+	return &randomPolicy{indexes: make(map[string]int), random: rand.New(source)}
+}
+
+func (r *randomPolicy) Inserted(key string) {
+	if _, ok := r.indexes[key]; !ok {
+		r.indexes[key] = len(r.keys)
+		r.keys = append(r.keys, key)
+	}
+}
+
+func (r *randomPolicy) Accessed(string) {}
+
+// Removed swaps the last key into the place of the one removed.
+func (r *randomPolicy) Removed(key string) {
+	index, ok := r.indexes[key]
+	if !ok {
+		return
+	}
+
+	last := r.keys[len(r.keys)-1]
+	r.keys[index] = last
+	r.indexes[last] = index
+	r.keys = r.keys[:len(r.keys)-1]
+
+	delete(r.indexes, key)
+}
+
+func (r *randomPolicy) Evicted(key string) {
+	r.Removed(key)
+}
+
+func (r *randomPolicy) Victim() (string, bool) {
+	if len(r.keys) == 0 {
+		return "", false
+	}
+
+	return r.keys[r.random.Intn(len(r.keys))], true
+}
@@ -0,0 +1,163 @@
+package store
+
+import (
+	"errors"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// evictAll empties policy returning the keys in the order it evicts them.
+func evictAll(policy Policy) []string {
+	var order []string
+
+	for key, ok := policy.Victim(); ok; key, ok = policy.Victim() {
+		policy.Evicted(key)
+		order = append(order, key)
+	}
+
+	return order
+}
+
+func TestParsePolicy(t *testing.T) {
+	for _, name := range []string{"lru", "lfu", "fifo", "random", "arc"} {
+		if newPolicy, err := ParsePolicy(name); err != nil || newPolicy(1) == nil {
+			t.Errorf("Expected %s to parse but got %v", name, err)
+		}
+	}
+
+	if _, err := ParsePolicy("mru"); !errors.Is(err, ErrPolicy) {
+		t.Errorf("Expected an unknown policy to fail but got %v", err)
+	}
+}
+
+func TestPolicyEvictionOrder(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy Policy
+		order  []string
+	}{
+		// a is used last so is evicted last
+		{name: "LRU", policy: newLRUPolicy(), order: []string{"b", "d", "c", "a"}},
+		// b and d are used once so go first, oldest first
+		{name: "LFU", policy: newLFUPolicy(), order: []string{"b", "d", "c", "a"}},
+		// use makes no difference
+		{name: "FIFO", policy: newFIFOPolicy(), order: []string{"a", "b", "c", "d"}},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			for _, key := range []string{"a", "b", "c", "d", "e"} {
+				test.policy.Inserted(key)
+			}
+
+			test.policy.Accessed("c")
+			test.policy.Accessed("a")
+			test.policy.Accessed("a")
+			test.policy.Removed("e")
+
+			if order := evictAll(test.policy); !reflect.DeepEqual(order, test.order) {
+				t.Errorf("Expected eviction order %v but got %v", test.order, order)
+			}
+		})
+	}
+}
+
+func TestRandomPolicy(t *testing.T) {
+	keys := []string{"a", "b", "c", "d", "e"}
+	first := newRandomPolicy(rand.NewSource(1))
+	second := newRandomPolicy(rand.NewSource(1))
+
+	for _, key := range keys {
+		first.Inserted(key)
+		second.Inserted(key)
+	}
+
+	first.Removed("c")
+	second.Removed("c")
+
+	order := evictAll(first)
+	if !reflect.DeepEqual(order, evictAll(second)) {
+		t.Error("Expected the same source to evict in the same order")
+	}
+
+	seen := make(map[string]bool)
+	for _, key := range order {
+		seen[key] = true
+	}
+
+	if len(order) != 4 || len(seen) != 4 || seen["c"] {
+		t.Errorf("Expected every key but c to be evicted once but got %v", order)
+	}
+}
+
+func TestARCPolicy(t *testing.T) {
+	arc := newARCPolicy(3)
+
+	var order []string
+
+	// evict then insert as a full shard does
+	insert := func(key string) {
+		if arc.once.len()+arc.often.len() >= arc.capacity {
+			victim, _ := arc.Victim()
+			arc.Evicted(victim)
+			order = append(order, victim)
+		}
+
+		arc.Inserted(key)
+	}
+
+	insert("a")
+	arc.Accessed("a")
+	insert("b")
+	insert("c")
+
+	// keys used once go before a, which has been used twice
+	insert("d")
+
+	// b returning after eviction grows the once used side, so it now holds
+	// c's place and the often used side gives up a
+	insert("b")
+	insert("e")
+
+	if expected := []string{"b", "c", "a"}; !reflect.DeepEqual(order, expected) {
+		t.Errorf("Expected eviction order %v but got %v", expected, order)
+	}
+
+	if arc.target != 1 || !arc.often.has("b") || !arc.once.has("d") || !arc.once.has("e") {
+		t.Errorf("Expected b often used, d and e once used with target 1 but got target %d", arc.target)
+	}
+
+	arc.Removed("b")
+
+	if arc.often.has("b") || arc.onceGhosts.has("b") || arc.oftenGhosts.has("b") {
+		t.Error("Expected a removed key to be forgotten entirely")
+	}
+}
+
+func TestStorePolicy(t *testing.T) {
+	newPolicy, err := ParsePolicy("lfu")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := openTestStore(t, Options{Depth: 3, Policy: newPolicy})
+	defer s.Close()
+
+	for _, key := range []string{"key1", "key2", "key3"} {
+		<-s.Upsert(key, "user1", "value")
+	}
+
+	<-s.Fetch("key1")
+	<-s.Fetch("key3")
+	<-s.Upsert("key4", "user1", "value")
+
+	if response := <-s.Fetch("key2"); response != nil {
+		t.Errorf("Expected the least frequently used key to be evicted but got %v", response)
+	}
+
+	if _, ok := (<-s.Fetch("key1")).(DataValue); !ok {
+		t.Error("Expected a frequently used key to be kept")
+	}
+}
@@ -0,0 +1,107 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ListSort what a list of keys is ordered by.
+type ListSort int
+
+const (
+	// SortKey orders by key, the only order a list can be paged through in.
+	SortKey ListSort = iota
+	// SortReads orders by how often each key has been read.
+	SortReads
+	// SortWrites orders by how often each key has been written.
+	SortWrites
+	// SortAge orders by how long since each key was last used.
+	SortAge
+)
+
+// ErrListSort is an unknown list order name.
+var ErrListSort = errors.New("unknown list order")
+
+// ParseListSort converts key, reads, writes or age to a ListSort.
+func ParseListSort(name string) (ListSort, error) {
+	switch name {
+	case "key", "":
+		return SortKey, nil
+	case "reads":
+		return SortReads, nil
+	case "writes":
+		return SortWrites, nil
+	case "age":
+		return SortAge, nil
+	}
+
+	return SortKey, fmt.Errorf("%w: %s", ErrListSort, name)
+}
+
+// ListQuery filters and orders the keys a scan lists. Owner only lists keys
+// it owns, MinReads those read at least that often and OlderThan those not
+// used for at least that long, each only if set. Keys are sorted by Sort,
+// highest first if Descending, and only a list sorted by key in ascending
+// order can be paged through, any other returning the first Limit keys of
+// the range.
+type ListQuery struct {
+	Owner      string
+	MinReads   int
+	OlderThan  time.Duration
+	Sort       ListSort
+	Descending bool
+}
+
+// allowed reports whether who may list keys by the owner the query asks for,
+// which they may if they are or belong to it, or are admin.
+func (q ListQuery) allowed(who identity) bool {
+	return q.Owner == "" || who.user == admin || who.is(q.Owner)
+}
+
+// matches reports whether value passes the query's filters at now, in unix
+// nanoseconds.
+func (q ListQuery) matches(value DataValue, now int64) bool {
+	return (q.Owner == "" || value.Owner == q.Owner) &&
+		value.Reads >= q.MinReads &&
+		now-value.Timestamp >= int64(q.OlderThan)
+}
+
+// paged reports whether the list is in the order it is paged through.
+func (q ListQuery) paged() bool {
+	return q.Sort == SortKey && !q.Descending
+}
+
+// sort orders list as the query asks, by key among equals.
+func (q ListQuery) sort(list []ListValue) {
+	field := func(value ListValue) int64 {
+		switch q.Sort {
+		case SortReads:
+			return int64(value.Reads)
+		case SortWrites:
+			return int64(value.Writes)
+		case SortAge:
+			return value.Age
+		}
+
+		return 0
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		a, b := field(list[i]), field(list[j])
+		if a == b {
+			if q.Descending && q.Sort == SortKey {
+				return list[i].Key > list[j].Key
+			}
+
+			return list[i].Key < list[j].Key
+		}
+
+		if q.Descending {
+			return a > b
+		}
+
+		return a < b
+	})
+}
@@ -0,0 +1,65 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestScanQuery(t *testing.T) {
+	s := openTestStore(t, Options{Depth: DefaultDepth, Shards: 4})
+	defer s.Close()
+
+	for i, key := range []string{"key1", "key2", "key3", "key4"} {
+		<-s.Upsert(key, "user1", "value")
+
+		for j := 0; j < i; j++ {
+			<-s.Fetch(key)
+		}
+	}
+
+	<-s.Upsert("key5", "user2", "value")
+	<-s.Fetch("key5")
+
+	keys := func(page ListPage) string {
+		var keys []string
+		for _, value := range page.Keys {
+			keys = append(keys, value.Key)
+		}
+
+		return fmt.Sprint(keys)
+	}
+
+	page := <-s.Scan(admin, KeyRange{Limit: 2}, ListQuery{Sort: SortReads, Descending: true})
+	if keys(page) != "[key4 key3]" || page.Next != "" {
+		t.Errorf("Expected the two most read keys without a cursor but got %s, %q", keys(page), page.Next)
+	}
+
+	page = <-s.Scan(admin, KeyRange{}, ListQuery{Owner: "user1", MinReads: 1})
+	if keys(page) != "[key2 key3 key4]" {
+		t.Errorf("Expected user1's keys read at least once but got %s", keys(page))
+	}
+
+	page = <-s.Scan("user1", KeyRange{}, ListQuery{Sort: SortKey, Descending: true})
+	if keys(page) != "[key4 key3 key2 key1]" {
+		t.Errorf("Expected the keys in reverse order but got %s", keys(page))
+	}
+
+	if page = <-s.Scan("user1", KeyRange{}, ListQuery{OlderThan: time.Hour}); len(page.Keys) != 0 {
+		t.Errorf("Expected no keys unused for an hour but got %s", keys(page))
+	}
+
+	if page = <-s.Scan("user1", KeyRange{}, ListQuery{Owner: "user2"}); page.Err != ErrForbidden {
+		t.Errorf("Expected only admin to list another user's keys but got %v", page.Err)
+	}
+}
+
+func TestParseListSort(t *testing.T) {
+	if sortBy, err := ParseListSort("writes"); err != nil || sortBy != SortWrites {
+		t.Errorf("Expected writes but got %v, %v", sortBy, err)
+	}
+
+	if _, err := ParseListSort("size"); err == nil {
+		t.Error("Expected an unknown order to be refused")
+	}
+}
@@ -0,0 +1,230 @@
+package store
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrQuotaExceeded is a write that would take an owner over their quota.
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// Quota limits the keys an owner may hold and the bytes of their values, a
+// limit of zero being no limit.
+type Quota struct {
+	Keys  int   `json:"keys"`
+	Bytes int64 `json:"bytes"`
+}
+
+// Usage is what an owner holds against their quota.
+type Usage struct {
+	Owner string `json:"owner"`
+	Keys  int    `json:"keys"`
+	Bytes int64  `json:"bytes"`
+	Quota Quota  `json:"quota"`
+}
+
+// usage is a change to what an owner holds.
+type usage struct {
+	keys  int
+	bytes int64
+}
+
+// quotas tracks what each owner holds across every shard so a write can be
+// checked against the owner's quota whichever shard it lands in.
+type quotas struct {
+	mutex     sync.Mutex
+	standard  Quota
+	overrides map[string]Quota
+	held      map[string]usage
+}
+
+func newQuotas(standard Quota) *quotas {
+	return &quotas{standard: standard, overrides: make(map[string]Quota), held: make(map[string]usage)}
+}
+
+// limit is the quota for owner, admin having none.
+func (q *quotas) limit(owner string) Quota {
+	if owner == admin {
+		return Quota{}
+	}
+
+	if quota, ok := q.overrides[owner]; ok {
+		return quota
+	}
+
+	return q.standard
+}
+
+// charge applies changes to what owners hold if none of them takes an owner
+// over their quota. Changes that only lower what an owner holds always apply.
+func (q *quotas) charge(changes map[string]usage) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if err := q.exceeded(changes); err != nil {
+		return err
+	}
+
+	for owner, change := range changes {
+		q.add(owner, change)
+	}
+
+	return nil
+}
+
+// check reports whether changes would take an owner over their quota
+// without applying them.
+func (q *quotas) check(changes map[string]usage) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return q.exceeded(changes)
+}
+
+func (q *quotas) exceeded(changes map[string]usage) error {
+	for owner, change := range changes {
+		quota := q.limit(owner)
+		held := q.held[owner]
+
+		if change.keys > 0 && quota.Keys > 0 && held.keys+change.keys > quota.Keys {
+			return ErrQuotaExceeded
+		}
+
+		if change.bytes > 0 && quota.Bytes > 0 && held.bytes+change.bytes > quota.Bytes {
+			return ErrQuotaExceeded
+		}
+	}
+
+	return nil
+}
+
+// apply applies changes to what owners hold without checking their quotas,
+// for changes admin makes on their behalf.
+func (q *quotas) apply(changes map[string]usage) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for owner, change := range changes {
+		q.add(owner, change)
+	}
+}
+
+// refund reverses changes that were charged.
+func (q *quotas) refund(changes map[string]usage) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for owner, change := range changes {
+		q.add(owner, usage{keys: -change.keys, bytes: -change.bytes})
+	}
+}
+
+// hold records the owner of value holding it.
+func (q *quotas) hold(value DataValue) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.add(value.Owner, valueUsage(value))
+}
+
+// release records the owner of value no longer holding it.
+func (q *quotas) release(value DataValue) {
+	q.refund(map[string]usage{value.Owner: valueUsage(value)})
+}
+
+func (q *quotas) add(owner string, change usage) {
+	held := q.held[owner]
+	held.keys += change.keys
+	held.bytes += change.bytes
+
+	if held.keys == 0 && held.bytes == 0 {
+		delete(q.held, owner)
+		return
+	}
+
+	q.held[owner] = held
+}
+
+// valueUsage is what holding value counts against its owner.
+func valueUsage(value DataValue) usage {
+	return usage{keys: 1, bytes: int64(len(value.Value))}
+}
+
+// addChange adds to changes the effect of replacing before with after, either
+// of which may be nil.
+func addChange(changes map[string]usage, before, after *DataValue) {
+	if before != nil {
+		change := changes[before.Owner]
+		change.keys--
+		change.bytes -= int64(len(before.Value))
+		changes[before.Owner] = change
+	}
+
+	if after != nil {
+		change := changes[after.Owner]
+		change.keys++
+		change.bytes += int64(len(after.Value))
+		changes[after.Owner] = change
+	}
+}
+
+// Usage returns what user, or group, holds and their quota. Users can only
+// see their own usage and that of their groups, admin can see anyone's.
+func (s *Store) Usage(caller, user string) (Usage, error) {
+	if !s.identify(caller).is(user) && caller != admin {
+		return Usage{}, ErrForbidden
+	}
+
+	s.quotas.mutex.Lock()
+	defer s.quotas.mutex.Unlock()
+
+	held := s.quotas.held[user]
+
+	return Usage{Owner: user, Keys: held.keys, Bytes: held.bytes, Quota: s.quotas.limit(user)}, nil
+}
+
+// SetQuota overrides the default quota for user, or goes back to the default
+// if quota is nil. Only admin may. Keys already held over a lowered quota are
+// kept but no more can be added.
+func (s *Store) SetQuota(caller, user string, quota *Quota) error {
+	if caller != admin {
+		return ErrForbidden
+	}
+
+	// pause so the change is ordered with snapshots
+	resume := s.pause()
+	defer resume()
+
+	if err := s.commit(walRecord{Op: walQuota, Key: user, Quota: quota}); err != nil {
+		return err
+	}
+
+	s.quotas.override(user, quota)
+
+	return nil
+}
+
+func (q *quotas) override(user string, quota *Quota) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if quota == nil {
+		delete(q.overrides, user)
+		return
+	}
+
+	q.overrides[user] = *quota
+}
+
+// copyOverrides returns the quotas set for particular users.
+func (q *quotas) copyOverrides() map[string]Quota {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	overrides := make(map[string]Quota, len(q.overrides))
+	for user, quota := range q.overrides {
+		overrides[user] = quota
+	}
+
+	return overrides
+}
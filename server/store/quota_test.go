@@ -0,0 +1,104 @@
+package store
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestQuotaKeys(t *testing.T) {
+	s := openTestStore(t, Options{Depth: 3, Quota: Quota{Keys: 2}})
+	defer s.Close()
+
+	<-s.Upsert("key1", "user1", "value")
+	<-s.Upsert("key2", "user1", "value")
+	<-s.Upsert("key3", "user2", "value")
+
+	if response := <-s.Upsert("key4", "user1", "value"); response != ErrQuotaExceeded {
+		t.Errorf("Expected a third key to exceed the quota but got %v", response)
+	}
+
+	if _, ok := (<-s.Fetch("key3")).(DataValue); !ok {
+		t.Error("Expected another user's key not to be evicted for a write over quota")
+	}
+
+	if response := <-s.Upsert("key1", "user1", "value2"); !stored(response) {
+		t.Errorf("Expected updating a key within quota to succeed but got %v", response)
+	}
+
+	<-s.Delete("key2", "user1")
+
+	if response := <-s.Upsert("key4", "user1", "value"); !stored(response) {
+		t.Errorf("Expected deleting a key to free quota but got %v", response)
+	}
+
+	if response := <-s.Upsert("key5", admin, "value"); !stored(response) {
+		t.Errorf("Expected admin to have no quota but got %v", response)
+	}
+}
+
+func TestQuotaBytes(t *testing.T) {
+	s := openTestStore(t, Options{Depth: DefaultDepth, Quota: Quota{Bytes: 10}})
+	defer s.Close()
+
+	<-s.Upsert("key1", "user1", "12345")
+	<-s.Upsert("key1", "user1", "1234567890")
+
+	if response := <-s.Upsert("key2", "user1", "1"); response != ErrQuotaExceeded {
+		t.Errorf("Expected a value over the byte quota to fail but got %v", response)
+	}
+
+	usage, err := s.Usage("user1", "user1")
+	if err != nil || usage.Keys != 1 || usage.Bytes != 10 || usage.Quota.Bytes != 10 {
+		t.Errorf("Expected 1 key of 10 bytes against a quota of 10 but got %v, %v", usage, err)
+	}
+
+	if _, err = s.Usage("user2", "user1"); err != ErrForbidden {
+		t.Errorf("Expected reading another user's usage to be forbidden but got %v", err)
+	}
+
+	response := <-s.Transaction(TxnRequest{
+		Owner:      "user1",
+		Operations: []TxnOperation{{Op: TxnPut, Key: "key2", Value: "1"}},
+	})
+	if !errors.Is(response.Err, ErrQuotaExceeded) || response.Failed == nil || response.Failed.Index != 0 {
+		t.Errorf("Expected a transaction over quota to fail at its put but got %v", response)
+	}
+}
+
+func TestQuotaOverride(t *testing.T) {
+	dir := t.TempDir()
+
+	s := openTestStore(t, Options{Depth: DefaultDepth, DataDir: dir, Quota: Quota{Keys: 1}})
+
+	if err := s.SetQuota("user1", "user1", &Quota{Keys: 2}); err != ErrForbidden {
+		t.Errorf("Expected only admin to set quotas but got %v", err)
+	}
+
+	if err := s.SetQuota(admin, "user1", &Quota{Keys: 2}); err != nil {
+		t.Fatalf("Expected admin to set a quota but got %v", err)
+	}
+
+	<-s.Upsert("key1", "user1", "value")
+
+	if response := <-s.Upsert("key2", "user1", "value"); !stored(response) {
+		t.Errorf("Expected the override to allow a second key but got %v", response)
+	}
+
+	s.Close()
+
+	s = openTestStore(t, Options{Depth: DefaultDepth, DataDir: dir, Quota: Quota{Keys: 1}})
+	defer s.Close()
+
+	usage, _ := s.Usage(admin, "user1")
+	if usage.Keys != 2 || usage.Quota.Keys != 2 {
+		t.Errorf("Expected the override and usage to be restored but got %v", usage)
+	}
+
+	if err := s.SetQuota(admin, "user1", nil); err != nil {
+		t.Fatalf("Expected admin to clear a quota but got %v", err)
+	}
+
+	if usage, _ = s.Usage(admin, "user1"); usage.Quota.Keys != 1 {
+		t.Errorf("Expected clearing the override to return to the default but got %v", usage)
+	}
+}
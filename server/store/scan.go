@@ -0,0 +1,220 @@
+package store
+
+import (
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// maxIndexLevel bounds the levels of the key index, enough for far more keys
+// than a store holds.
+const maxIndexLevel = 24
+
+// KeyRange selects keys in order: those starting with Prefix, from Start and
+// before End, each only if set, and after the key After. After is how a scan
+// carries on from the last key of the previous page so, unlike an offset, a
+// key written or deleted meanwhile never moves the page boundary. No more
+// than Limit keys are returned if it is set.
+type KeyRange struct {
+	Prefix string
+	Start  string
+	End    string
+	After  string
+	Limit  int
+}
+
+// ListPage a page of keys in order. Next is the key to scan after for the
+// following page, empty if there are no more or the list cannot be paged.
+type ListPage struct {
+	Keys []ListValue
+	Next string
+	Err  error
+}
+
+// from is the first key the range could hold.
+func (r KeyRange) from() string {
+	from := r.Start
+	if r.Prefix > from {
+		from = r.Prefix
+	}
+
+	if r.After > from {
+		from = r.After
+	}
+
+	return from
+}
+
+// past reports whether key, and so every key after it, is beyond the range.
+// Keys before from never reach it.
+func (r KeyRange) past(key string) bool {
+	return !strings.HasPrefix(key, r.Prefix) || (r.End != "" && key >= r.End)
+}
+
+// keyNode a key in the index, linked to the next key on each of its levels.
+type keyNode struct {
+	key  string
+	next []*keyNode
+}
+
+// keyIndex keeps a shard's keys in order as a skip list, so a range can be
+// scanned without sorting the whole shard. Like the shard's map it is only
+// used from the shard's goroutine.
+type keyIndex struct {
+	head  keyNode
+	level int
+	rand  *rand.Rand
+}
+
+func newKeyIndex() *keyIndex {
+	return &keyIndex{
+		head:  keyNode{next: make([]*keyNode, maxIndexLevel)},
+		level: 1,
+		rand:  rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// seek returns the node of the first key at or after key, recording the last
+// node before it on each level in path if given.
+func (k *keyIndex) seek(key string, path []*keyNode) *keyNode {
+	node := &k.head
+
+	for level := k.level - 1; level >= 0; level-- {
+		for node.next[level] != nil && node.next[level].key < key {
+			node = node.next[level]
+		}
+
+		if path != nil {
+			path[level] = node
+		}
+	}
+
+	return node.next[0]
+}
+
+// insert adds key if it is not already held.
+func (k *keyIndex) insert(key string) {
+	var path [maxIndexLevel]*keyNode
+
+	if next := k.seek(key, path[:]); next != nil && next.key == key {
+		return
+	}
+
+	// each level holds a quarter of the keys of the one below
+	level := 1
+	for level < maxIndexLevel && k.rand.Intn(4) == 0 {
+		level++
+	}
+
+	for ; k.level < level; k.level++ {
+		path[k.level] = &k.head
+	}
+
+	node := &keyNode{key: key, next: make([]*keyNode, level)}
+	for i := 0; i < level; i++ {
+		node.next[i] = path[i].next[i]
+		path[i].next[i] = node
+	}
+}
+
+// remove drops key if it is held.
+func (k *keyIndex) remove(key string) {
+	var path [maxIndexLevel]*keyNode
+
+	node := k.seek(key, path[:])
+	if node == nil || node.key != key {
+		return
+	}
+
+	for i := range node.next {
+		path[i].next[i] = node.next[i]
+	}
+
+	for k.level > 1 && k.head.next[k.level-1] == nil {
+		k.level--
+	}
+}
+
+// Scan lists the keys in r that owner may see and that match q, in the order
+// q asks for. The keys of each page are read as they are when it is scanned,
+// paging on from Next so a key that exists throughout is listed exactly once
+// however the store changes between pages. Err is ErrForbidden if owner may
+// not list the keys q asks for. Each shard is read at its own moment, so a
+// page need not be a single point in the store, ScanAt lists one.
+func (s *Store) Scan(owner string, r KeyRange, q ListQuery) chan ListPage {
+	responseChannel := make(chan ListPage, 1)
+
+	if !q.allowed(s.identify(owner)) {
+		responseChannel <- ListPage{Err: ErrForbidden}
+		return responseChannel
+	}
+
+	responses := make([]chan []ListValue, len(s.shards))
+
+	for i, sh := range s.shards {
+		responses[i] = make(chan []ListValue, 1)
+		sh.listChannel <- ListRequest{Owner: owner, Range: r, Query: q, Response: responses[i]}
+	}
+
+	go func() {
+		var page ListPage
+
+		for _, response := range responses {
+			page.Keys = append(page.Keys, <-response...)
+		}
+
+		q.sort(page.Keys)
+
+		if r.Limit > 0 && len(page.Keys) > r.Limit {
+			page.Keys = page.Keys[:r.Limit]
+
+			// each shard gives one more than the limit if it has it so a
+			// page that fills up knows whether there are more
+			if q.paged() {
+				page.Next = page.Keys[r.Limit-1].Key
+			}
+		}
+
+		responseChannel <- page
+	}()
+
+	return responseChannel
+}
+
+// scan lists the keys in r who may see that match q, in the order q asks
+// for. Listed by key there is one more than the limit if there are that
+// many, otherwise every match has to be sorted to find the first.
+func (sh *shard) scan(r KeyRange, q ListQuery, who identity, now int64) []ListValue {
+	var list []ListValue
+
+	for node := sh.keys.seek(r.from(), nil); node != nil; node = node.next[0] {
+		if r.past(node.key) {
+			break
+		}
+
+		if node.key == r.After {
+			continue
+		}
+
+		value := sh.value[node.key]
+		if value.expired(now) || !value.listable(who) || !q.matches(value, now) {
+			continue
+		}
+
+		list = append(list, listValue(node.key, value, who, now))
+
+		if r.Limit > 0 && len(list) > r.Limit && q.paged() {
+			break
+		}
+	}
+
+	if !q.paged() {
+		q.sort(list)
+
+		if r.Limit > 0 && len(list) > r.Limit {
+			list = list[:r.Limit]
+		}
+	}
+
+	return list
+}
@@ -0,0 +1,136 @@
+package store
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestKeyIndex(t *testing.T) {
+	index := newKeyIndex()
+
+	for _, key := range []string{"c", "a", "e", "b", "d", "a"} {
+		index.insert(key)
+	}
+
+	index.remove("c")
+	index.remove("z")
+
+	var keys []string
+	for node := index.seek("", nil); node != nil; node = node.next[0] {
+		keys = append(keys, node.key)
+	}
+
+	if fmt.Sprint(keys) != "[a b d e]" {
+		t.Errorf("Expected the keys in order without duplicates but got %v", keys)
+	}
+
+	if node := index.seek("bb", nil); node == nil || node.key != "d" {
+		t.Errorf("Expected to seek to the next key but got %v", node)
+	}
+}
+
+func TestScan(t *testing.T) {
+	s := openTestStore(t, Options{Depth: DefaultDepth})
+	defer s.Close()
+
+	for _, key := range []string{"app/3", "app/1", "web/1", "app/2", "apple"} {
+		<-s.Upsert(key, "user1", "value")
+	}
+
+	<-s.Upsert("app/4", "user2", "value")
+
+	tests := []struct {
+		name  string
+		r     KeyRange
+		keys  string
+		next  string
+		owner string
+	}{
+		{name: "All", r: KeyRange{}, keys: "[app/1 app/2 app/3 apple web/1]"},
+		{name: "Prefix", r: KeyRange{Prefix: "app/"}, keys: "[app/1 app/2 app/3]"},
+		{name: "Range", r: KeyRange{Start: "app/2", End: "web"}, keys: "[app/2 app/3 apple]"},
+		{name: "Limit", r: KeyRange{Prefix: "app", Limit: 2}, keys: "[app/1 app/2]", next: "app/2"},
+		{name: "After", r: KeyRange{Prefix: "app", After: "app/2", Limit: 2}, keys: "[app/3 apple]"},
+		{name: "Admin", r: KeyRange{Prefix: "app/"}, keys: "[app/1 app/2 app/3 app/4]", owner: admin},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			owner := test.owner
+			if owner == "" {
+				owner = "user1"
+			}
+
+			page := <-s.Scan(owner, test.r, ListQuery{})
+
+			var keys []string
+			for _, value := range page.Keys {
+				keys = append(keys, value.Key)
+			}
+
+			if fmt.Sprint(keys) != test.keys || page.Next != test.next {
+				t.Errorf("Expected %s next %q but got %v next %q", test.keys, test.next, keys, page.Next)
+			}
+		})
+	}
+}
+
+func TestScanPagesAreStable(t *testing.T) {
+	s := openTestStore(t, Options{Depth: 1000, Shards: 4})
+	defer s.Close()
+
+	for i := 0; i < 200; i++ {
+		<-s.Upsert(fmt.Sprintf("key%03d", i), "user1", "value")
+	}
+
+	// churn other keys in and out of the range while paging
+	stop := make(chan struct{})
+
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			key := fmt.Sprintf("key%03d-extra", i%200)
+			<-s.Upsert(key, "user1", "value")
+			<-s.Delete(key, "user1")
+		}
+	}()
+
+	seen := make(map[string]int)
+	r := KeyRange{Limit: 7}
+
+	for {
+		page := <-s.Scan("user1", r, ListQuery{})
+
+		for _, value := range page.Keys {
+			seen[value.Key]++
+		}
+
+		if page.Next == "" {
+			break
+		}
+
+		r.After = page.Next
+	}
+
+	close(stop)
+	wg.Wait()
+
+	for i := 0; i < 200; i++ {
+		if key := fmt.Sprintf("key%03d", i); seen[key] != 1 {
+			t.Fatalf("Expected %s to be listed once but it was listed %d times", key, seen[key])
+		}
+	}
+}
@@ -0,0 +1,647 @@
+package store
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// pauseRequest holds a shard between transactions until Resume is closed so
+// work spanning the whole store sees it at a single point in time.
+type pauseRequest struct {
+	Paused chan struct{}
+	Resume chan struct{}
+}
+
+// shard holds part of the keyspace along with its own eviction policy and the
+// goroutines serialising access to it. EvictableKeys and evictableBytes are
+// the keys its policy may evict, those not pinned, and the memory they use.
+// Across is set while every shard is paused so a write may evict from any of
+// them.
+type shard struct {
+	store              *Store
+	value              map[string]DataValue
+	keys               *keyIndex
+	policy             Policy
+	depth              int
+	evictableKeys      int64
+	evictableBytes     int64
+	across             bool
+	upsertChannel      chan UpsertRequest
+	deleteChannel      chan DeleteRequest
+	fetchChannel       chan FetchRequest
+	listChannel        chan ListRequest
+	pinChannel         chan PinRequest
+	grantChannel       chan GrantRequest
+	historyChannel     chan HistoryRequest
+	transferChannel    chan transferRequest
+	pauseChannel       chan pauseRequest
+	transactionChannel chan interface{}
+	done               chan doneRequest
+	stopped            chan struct{}
+	expiries           expiryQueue
+	timer              *time.Timer
+	wake               <-chan time.Time
+	wakeAt             int64
+}
+
+func newShard(s *Store, depth int, policy Policy) *shard {
+	return &shard{
+		store:              s,
+		value:              make(map[string]DataValue),
+		keys:               newKeyIndex(),
+		policy:             policy,
+		depth:              depth,
+		upsertChannel:      make(chan UpsertRequest),
+		deleteChannel:      make(chan DeleteRequest),
+		fetchChannel:       make(chan FetchRequest),
+		listChannel:        make(chan ListRequest),
+		pinChannel:         make(chan PinRequest),
+		grantChannel:       make(chan GrantRequest),
+		historyChannel:     make(chan HistoryRequest),
+		transferChannel:    make(chan transferRequest),
+		pauseChannel:       make(chan pauseRequest),
+		transactionChannel: make(chan interface{}),
+		done:               make(chan doneRequest),
+		stopped:            make(chan struct{}),
+	}
+}
+
+// start the goroutines monitoring the shard.
+func (sh *shard) start() {
+	go sh.transactionMonitor()
+	go sh.monitor()
+}
+
+// stop the shard goroutines and wait for them to finish.
+func (sh *shard) stop() {
+	sh.done <- doneRequest{}
+	<-sh.stopped
+}
+
+// pause waits for the shard to finish its current transaction and hold.
+func (sh *shard) pause(resume chan struct{}) {
+	paused := make(chan struct{})
+	sh.pauseChannel <- pauseRequest{Paused: paused, Resume: resume}
+	<-paused
+}
+
+// monitor checks for store transaction messages and acts accordingly.
+func (sh *shard) monitor() {
+	loop := true
+
+	for loop {
+		select {
+		case value := <-sh.upsertChannel:
+			sh.transactionChannel <- value
+		case listreq := <-sh.listChannel:
+			sh.transactionChannel <- listreq
+		case freq := <-sh.fetchChannel:
+			sh.transactionChannel <- freq
+		case dreq := <-sh.deleteChannel:
+			sh.transactionChannel <- dreq
+		case pinreq := <-sh.pinChannel:
+			sh.transactionChannel <- pinreq
+		case greq := <-sh.grantChannel:
+			sh.transactionChannel <- greq
+		case hreq := <-sh.historyChannel:
+			sh.transactionChannel <- hreq
+		case treq := <-sh.transferChannel:
+			sh.transactionChannel <- treq
+		case preq := <-sh.pauseChannel:
+			sh.transactionChannel <- preq
+		case req := <-sh.done:
+			sh.transactionChannel <- req
+
+			loop = false
+		}
+	}
+}
+
+func (sh *shard) transactionMonitor() {
+	defer close(sh.stopped)
+
+	for {
+		var transaction interface{}
+
+		select {
+		case transaction = <-sh.transactionChannel:
+		case <-sh.wake:
+			sh.sweep()
+			continue
+		}
+
+		if _, ok := transaction.(doneRequest); ok {
+			if sh.timer != nil {
+				sh.timer.Stop()
+			}
+
+			break
+		}
+		// upsert transaction
+		if msg, ok := transaction.(UpsertRequest); ok {
+			sh.transactionUpsert(msg)
+			continue
+		}
+		// delete transaction
+		if msg, ok := transaction.(DeleteRequest); ok {
+			sh.transactionDelete(msg)
+			continue
+		}
+		// fetch transaction
+		if msg, ok := transaction.(FetchRequest); ok {
+			sh.transactionFetch(msg)
+			continue
+		}
+		// list transaction
+		if msg, ok := transaction.(ListRequest); ok {
+			sh.transactionList(msg)
+			continue
+		}
+		// pin transaction
+		if msg, ok := transaction.(PinRequest); ok {
+			sh.transactionPin(msg)
+			continue
+		}
+		// grant transaction
+		if msg, ok := transaction.(GrantRequest); ok {
+			sh.transactionGrant(msg)
+			continue
+		}
+		// history transaction
+		if msg, ok := transaction.(HistoryRequest); ok {
+			sh.transactionHistory(msg)
+			continue
+		}
+		// transfer transaction
+		if msg, ok := transaction.(transferRequest); ok {
+			sh.transactionTransfer(msg)
+			continue
+		}
+		// pause transaction
+		if msg, ok := transaction.(pauseRequest); ok {
+			close(msg.Paused)
+			<-msg.Resume
+
+			continue
+		}
+	}
+}
+
+func (sh *shard) transactionDelete(msg DeleteRequest) {
+	entry, ok := sh.lookup(msg.Key)
+
+	switch {
+	case ok && !entry.allows(sh.store.identify(msg.Owner), rightDelete):
+		msg.Response <- ErrForbidden
+	case msg.Condition.check(entry, ok) != nil:
+		msg.Response <- ErrPreconditionFailed
+	case !ok:
+		msg.Response <- ErrNotFound
+	default:
+		msg.Response <- sh.remove(msg.Key)
+	}
+}
+
+func (sh *shard) transactionUpsert(msg UpsertRequest) {
+	current, ok := sh.lookup(msg.Key)
+	who := sh.store.identify(msg.Owner)
+
+	if ok && !current.allows(who, rightWrite) {
+		msg.Response <- ErrForbidden
+		return
+	}
+
+	// only a new key takes the group as its owner, but the caller must
+	// belong to it either way
+	owner := msg.Owner
+	if msg.Group != "" {
+		if !who.groups[msg.Group] {
+			msg.Response <- ErrForbidden
+			return
+		}
+
+		owner = msg.Group
+	}
+
+	// restoring writes an earlier version again, only for those who own it
+	if msg.Restore != 0 {
+		if err := restoring(&msg, current, ok, who); err != nil {
+			msg.Response <- err
+			return
+		}
+	}
+
+	if sh.store.tooLarge(msg.Value) {
+		msg.Response <- ErrTooLarge
+		return
+	}
+
+	if err := msg.Condition.check(current, ok); err != nil {
+		msg.Response <- err
+		return
+	}
+
+	now := time.Now().UnixNano()
+
+	value := DataValue{
+		Owner:           owner,
+		Value:           msg.Value,
+		ContentType:     msg.ContentType,
+		ContentEncoding: msg.ContentEncoding,
+		Timestamp:       now,
+		Writer:          msg.Owner,
+		Modified:        now,
+		HistoryLimit:    msg.HistoryLimit,
+		Writes:          1,
+		Reads:           0,
+	}
+
+	switch {
+	case msg.TTL > 0:
+		value.Expires = now + int64(msg.TTL)
+	case ok && !msg.ClearTTL:
+		value.Expires = current.Expires
+	}
+
+	if ok {
+		// updating keeps the owner, counters, grants and any offer
+		value.Owner = current.Owner
+		value.Writes = current.Writes + 1
+		value.Reads = current.Reads
+		value.Pinned = current.Pinned
+		value.ACL = current.ACL
+		value.Offer = current.Offer
+
+		if msg.HistoryLimit == nil {
+			value.HistoryLimit = current.HistoryLimit
+		}
+
+		value.History = current.revised(sh.store.keep(value))
+	}
+
+	err := sh.write(msg.Key, &value, current, ok)
+
+	switch {
+	case errors.Is(err, errNoRoom):
+		// evicting from other shards means waiting on them, so the write is
+		// tried again once this shard's transaction is over
+		go sh.store.acrossShards(sh, func() { sh.transactionUpsert(msg) })
+		return
+	case err != nil:
+		msg.Response <- err
+		return
+	}
+
+	msg.Response <- value
+}
+
+// write stores a new value for key, which currently has the value current if
+// ok, charging the owner's quota and making room for it.
+func (sh *shard) write(key string, value *DataValue, current DataValue, ok bool) error {
+	// a key that has expired but not yet been swept is replaced as a new one
+	if _, stale := sh.value[key]; stale && !ok {
+		if err := sh.expire(key); err != nil {
+			return err
+		}
+	}
+
+	// check there is room, and the owner's quota, before evicting anything
+	if err := sh.room(key, entrySize(key, *value)); err != nil {
+		return err
+	}
+
+	changes := make(map[string]usage)
+	if ok {
+		addChange(changes, &current, value)
+	} else {
+		addChange(changes, nil, value)
+	}
+
+	if err := sh.store.quotas.charge(changes); err != nil {
+		return err
+	}
+
+	claimed, err := sh.makeRoom(key, *value)
+	if err != nil {
+		sh.store.quotas.refund(changes)
+		return err
+	}
+
+	// making room may have evicted the key itself, releasing what was
+	// already taken into account when charging
+	_, held := sh.value[key]
+	selfEvicted := ok && !held
+
+	if selfEvicted {
+		sh.store.quotas.hold(current)
+	}
+
+	if held {
+		err = sh.put(key, value)
+	} else {
+		err = sh.insert(key, value)
+	}
+
+	if err != nil {
+		atomic.AddInt64(&sh.store.bytes, -claimed)
+		sh.store.quotas.refund(changes)
+
+		if selfEvicted {
+			sh.store.quotas.release(current)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// insert stores a new key, first evicting from this shard if either the shard
+// or the store as a whole is full.
+func (sh *shard) insert(key string, value *DataValue) error {
+	if len(sh.value) >= sh.depth {
+		if err := sh.evict(); err != nil {
+			return err
+		}
+	}
+
+	if err := sh.reserve(); err != nil {
+		return err
+	}
+
+	if err := sh.put(key, value); err != nil {
+		atomic.AddInt64(&sh.store.count, -1)
+		return err
+	}
+
+	return nil
+}
+
+// reserve claims room for a new key in the store, evicting from this shard
+// until there is some. Room has already checked this shard has a key to
+// evict, or evicted from every shard, so it is only full if other shards
+// took the room meanwhile.
+func (sh *shard) reserve() error {
+	for {
+		count := atomic.LoadInt64(&sh.store.count)
+
+		if count < int64(sh.store.depth) {
+			if atomic.CompareAndSwapInt64(&sh.store.count, count, count+1) {
+				return nil
+			}
+
+			continue
+		}
+
+		if len(sh.value) == 0 {
+			return ErrStoreFull
+		}
+
+		if err := sh.evict(); err != nil {
+			return err
+		}
+	}
+}
+
+// evict removes the key the shard's policy chooses, ErrStoreFull if there is
+// nothing to evict.
+func (sh *shard) evict() error {
+	victim, ok := sh.policy.Victim()
+	if !ok {
+		return ErrStoreFull
+	}
+
+	return sh.drop(victim, EventEvict, sh.policy.Evicted)
+}
+
+// put commits and stores a new value for key, setting its version.
+func (sh *shard) put(key string, value *DataValue) error {
+	if err := sh.store.commit(walRecord{Op: walUpsert, Key: key, Entry: value}); err != nil {
+		return err
+	}
+
+	sh.set(key, *value)
+
+	return nil
+}
+
+// set stores value for key, telling the policy and scheduling its expiry if
+// it has a new one. Pinned keys are kept out of the policy so it never offers
+// them for eviction.
+func (sh *shard) set(key string, value DataValue) {
+	previous, ok := sh.value[key]
+
+	if ok {
+		sh.tally(key, previous, -1)
+	}
+
+	sh.value[key] = value
+	sh.tally(key, value, 1)
+
+	if !ok {
+		sh.keys.insert(key)
+	}
+
+	switch {
+	case value.Pinned:
+		sh.policy.Removed(key)
+	case ok && !previous.Pinned:
+		sh.policy.Accessed(key)
+	default:
+		sh.policy.Inserted(key)
+	}
+
+	if value.Expires != 0 && (!ok || previous.Expires != value.Expires) {
+		sh.schedule(key, value.Expires)
+	}
+}
+
+// unset removes key from the shard's values and key index. The policy is
+// told separately as what it is told depends on why the key went.
+func (sh *shard) unset(key string) {
+	if value, ok := sh.value[key]; ok {
+		sh.tally(key, value, -1)
+	}
+
+	delete(sh.value, key)
+	sh.keys.remove(key)
+}
+
+// tally adds value to, or with sign -1 takes it from, what the shard's policy
+// may evict, unless it is pinned.
+func (sh *shard) tally(key string, value DataValue, sign int64) {
+	if !value.Pinned {
+		sh.evictableKeys += sign
+		sh.evictableBytes += sign * entrySize(key, value)
+	}
+}
+
+// remove commits and removes key.
+func (sh *shard) remove(key string) error {
+	return sh.drop(key, EventDelete, sh.policy.Removed)
+}
+
+// expire commits and removes key as it has expired.
+func (sh *shard) expire(key string) error {
+	return sh.drop(key, EventExpire, sh.policy.Removed)
+}
+
+// drop commits and removes key for cause, telling the policy through forget.
+func (sh *shard) drop(key string, cause EventType, forget func(string)) error {
+	if err := sh.store.commit(walRecord{Op: walDelete, Key: key, cause: cause}); err != nil {
+		return err
+	}
+
+	atomic.AddInt64(&sh.store.bytes, -sh.size(key))
+
+	if sh.value[key].Pinned {
+		atomic.AddInt64(&sh.store.pinned, -1)
+	}
+
+	sh.store.quotas.release(sh.value[key])
+
+	sh.unset(key)
+	forget(key)
+	atomic.AddInt64(&sh.store.count, -1)
+
+	return nil
+}
+
+// apply a record replayed from the write-ahead log.
+func (sh *shard) apply(record walRecord) {
+	switch record.Op {
+	case walUpsert:
+		if record.Entry != nil {
+			value := *record.Entry
+			if len(record.Revisions) > 0 {
+				value.History = sh.value[record.Key].withVersions(record.Revisions)
+			}
+
+			sh.set(record.Key, value)
+		}
+	case walDelete:
+		sh.unset(record.Key)
+		sh.policy.Removed(record.Key)
+	}
+}
+
+// restoring replaces the value of a restore request with the version it
+// restores.
+func restoring(msg *UpsertRequest, current DataValue, ok bool, who identity) error {
+	if !ok {
+		return ErrNotFound
+	}
+
+	if !current.manages(who) {
+		return ErrForbidden
+	}
+
+	revision, found := current.revision(msg.Restore)
+	if !found {
+		return ErrNotFound
+	}
+
+	msg.Value = revision.Value
+	msg.ContentType = revision.ContentType
+	msg.ContentEncoding = revision.ContentEncoding
+
+	return nil
+}
+
+func (sh *shard) transactionFetch(msg FetchRequest) {
+	val, ok := sh.lookup(msg.Key)
+	if ok && (msg.Owner == "" || val.allows(sh.store.identify(msg.Owner), rightRead)) {
+		if msg.Version != 0 && msg.Version != val.Version {
+			msg.Response <- revisionValue(val, msg.Version)
+			return
+		}
+
+		val.Reads++
+		val.Timestamp = time.Now().UnixNano()
+		sh.value[msg.Key] = val
+		sh.policy.Accessed(msg.Key)
+		msg.Response <- val
+	} else {
+		msg.Response <- nil
+	}
+}
+
+// revisionValue returns an earlier version of val, nil if it is no longer
+// kept.
+func revisionValue(val DataValue, version uint64) interface{} {
+	revision, found := val.revision(version)
+	if !found {
+		return nil
+	}
+
+	val.Value = revision.Value
+	val.ContentType = revision.ContentType
+	val.ContentEncoding = revision.ContentEncoding
+	val.Version = revision.Version
+	val.Writer = revision.Writer
+	val.Modified = revision.Modified
+	val.History = nil
+
+	return val
+}
+
+func (sh *shard) transactionList(msg ListRequest) {
+	var responseList []ListValue
+
+	now := time.Now().UnixNano()
+	who := sh.store.identify(msg.Owner)
+
+	if msg.Key == "" {
+		// scan the keys in range and add them if owner may read them, they
+		// have been offered to owner or if owner = admin
+		msg.Response <- sh.scan(msg.Range, msg.Query, who, now)
+
+		return
+	}
+
+	val, ok := sh.lookup(msg.Key)
+	if ok {
+		// found the specific key, add it if owner may read it, it has been
+		// offered to owner or owner is admin
+		if val.listable(who) {
+			responseList = append(responseList, listValue(msg.Key, val, who, now))
+		}
+	}
+
+	msg.Response <- responseList
+}
+
+// listable reports whether who may see the value listed.
+func (d DataValue) listable(who identity) bool {
+	return d.allows(who, rightRead) || who.user == admin || (d.Offer != "" && who.is(d.Offer))
+}
+
+// listValue describes key for a list response to caller at now, in unix
+// nanoseconds.
+func listValue(key string, value DataValue, caller identity, now int64) ListValue {
+	listed := ListValue{
+		Key:    key,
+		Owner:  value.Owner,
+		Writes: value.Writes,
+		Reads:  value.Reads,
+		Size:   len(value.Value),
+		Age:    (now - value.Timestamp) / int64(time.Millisecond),
+		Pinned: value.Pinned,
+	}
+
+	if value.Expires != 0 {
+		expiresIn := (value.Expires - now) / int64(time.Millisecond)
+		listed.ExpiresIn = &expiresIn
+	}
+
+	if value.manages(caller) {
+		listed.ACL = value.ACL
+	}
+
+	if value.manages(caller) || (value.Offer != "" && caller.is(value.Offer)) {
+		listed.Offer = value.Offer
+	}
+
+	return listed
+}
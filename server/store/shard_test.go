@@ -0,0 +1,131 @@
+package store_test
+
+import (
+	"KeyValueStoreServer/server/store"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func newShardedStore(t *testing.T, opts store.Options) *store.Store {
+	t.Helper()
+
+	s, err := store.New(opts)
+	if err != nil {
+		t.Fatalf("Expected no error creating store but got %v", err)
+	}
+
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func TestShardedList(t *testing.T) {
+	s := newShardedStore(t, store.Options{Shards: 4})
+
+	for i := 0; i < 20; i++ {
+		owner := "user1"
+		if i%2 == 0 {
+			owner = "user2"
+		}
+
+		if response := <-s.Upsert(fmt.Sprintf("key%d", i), owner, "value"); isError(response) {
+			t.Errorf("expected no error but got %v", response)
+		}
+	}
+
+	if response := <-s.List("admin"); len(response) != 20 {
+		t.Errorf("Expected 20 entries for admin but got %d", len(response))
+	}
+
+	if response := <-s.List("user1"); len(response) != 10 {
+		t.Errorf("Expected 10 entries for user1 but got %d", len(response))
+	}
+
+	if response := <-s.ListForKey("key3", "user1"); len(response) != 1 {
+		t.Errorf("Expected 1 entry for user1 key3 but got %d", len(response))
+	}
+}
+
+func TestShardedDepth(t *testing.T) {
+	t.Run("Global", func(t *testing.T) {
+		// with Depth split evenly each shard evicts before the store is full
+		s := newShardedStore(t, store.Options{Shards: 4, Depth: 12})
+
+		for i := 0; i < 100; i++ {
+			if response := <-s.Upsert(fmt.Sprintf("key%d", i), "user1", "value"); isError(response) {
+				t.Errorf("expected no error but got %v", response)
+			}
+		}
+
+		if response := <-s.List("admin"); len(response) != 12 {
+			t.Errorf("Expected 12 entries but got %d", len(response))
+		}
+	})
+
+	t.Run("Empty shard", func(t *testing.T) {
+		// a full store holds one key, so nearly every key written lands in an
+		// empty shard which has to make room by evicting from the others
+		s := newShardedStore(t, store.Options{Shards: 4, Depth: 1, ShardDepth: 1})
+
+		for i := 0; i < 20; i++ {
+			if response := <-s.Upsert(fmt.Sprintf("key%d", i), "user1", "value"); isError(response) {
+				t.Errorf("expected no error but got %v", response)
+			}
+		}
+
+		if response := <-s.List("admin"); len(response) != 1 || response[0].Key != "key19" {
+			t.Errorf("Expected only the last key written to be kept but got %v", response)
+		}
+	})
+
+	t.Run("Shard", func(t *testing.T) {
+		s := newShardedStore(t, store.Options{Shards: 4, Depth: 100, ShardDepth: 2})
+
+		for i := 0; i < 100; i++ {
+			if response := <-s.Upsert(fmt.Sprintf("key%d", i), "user1", "value"); isError(response) {
+				t.Errorf("expected no error but got %v", response)
+			}
+		}
+
+		if response := <-s.List("admin"); len(response) != 8 {
+			t.Errorf("Expected 8 entries but got %d", len(response))
+		}
+	})
+}
+
+func TestShardedConcurrentAccess(t *testing.T) {
+	const workers, keys = 8, 50
+
+	s := newShardedStore(t, store.Options{Shards: 4, Depth: workers * keys})
+
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+
+		go func(w int) {
+			defer wg.Done()
+
+			owner := fmt.Sprintf("user%d", w)
+
+			for i := 0; i < keys; i++ {
+				key := fmt.Sprintf("%s-key%d", owner, i)
+
+				if response := <-s.Upsert(key, owner, "value"); isError(response) {
+					t.Errorf("expected no error but got %v", response)
+				}
+
+				if _, ok := (<-s.Fetch(key)).(store.DataValue); !ok {
+					t.Errorf("Expected to fetch %s", key)
+				}
+			}
+		}(w)
+	}
+
+	wg.Wait()
+
+	if response := <-s.List("admin"); len(response) != workers*keys {
+		t.Errorf("Expected %d entries but got %d", workers*keys, len(response))
+	}
+}
@@ -0,0 +1,304 @@
+package store
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// DefaultSnapshotRetain number of snapshots kept when none is given.
+const DefaultSnapshotRetain = 3
+
+const (
+	snapshotPrefix = "snapshot-"
+	snapshotSuffix = ".snap"
+)
+
+var errSnapshotLength = errors.New("snapshot has the wrong number of entries")
+
+// snapshotHeader is the first frame of a snapshot, Seq being the last change
+// the snapshot includes.
+type snapshotHeader struct {
+	Seq       uint64              `json:"seq"`
+	Count     int                 `json:"count"`
+	Created   int64               `json:"created"`
+	Quotas    map[string]Quota    `json:"quotas,omitempty"`
+	Transfers []Transfer          `json:"transfers,omitempty"`
+	Groups    map[string][]string `json:"groups,omitempty"`
+}
+
+// snapshotEntry is a frame for each key in a snapshot, least recently used
+// first so the order can be restored.
+type snapshotEntry struct {
+	Key   string    `json:"key"`
+	Entry DataValue `json:"entry"`
+}
+
+// snapshotCopy is a point in time copy of the store ready to be written.
+type snapshotCopy struct {
+	header  snapshotHeader
+	entries []snapshotEntry
+	err     error
+}
+
+func snapshotName(seq uint64) string {
+	return fmt.Sprintf("%s%020d%s", snapshotPrefix, seq, snapshotSuffix)
+}
+
+// writeSnapshot writes a snapshot to a temporary file and renames it into
+// place once it is safely on disk.
+func writeSnapshot(dir string, snapshot snapshotCopy) error {
+	file, err := os.CreateTemp(dir, snapshotPrefix+"*.tmp")
+	if err != nil {
+		return fmt.Errorf("creating snapshot: %w", err)
+	}
+
+	defer func() {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+	}()
+
+	writer := bufio.NewWriter(file)
+
+	if err = writeFrame(writer, snapshot.header); err != nil {
+		return err
+	}
+
+	for _, entry := range snapshot.entries {
+		if err = writeFrame(writer, entry); err != nil {
+			return err
+		}
+	}
+
+	if err = writer.Flush(); err != nil {
+		return fmt.Errorf("writing snapshot: %w", err)
+	}
+
+	if err = file.Sync(); err != nil {
+		return fmt.Errorf("flushing snapshot: %w", err)
+	}
+
+	if err = os.Rename(file.Name(), filepath.Join(dir, snapshotName(snapshot.header.Seq))); err != nil {
+		return fmt.Errorf("renaming snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// readSnapshot reads a whole snapshot, failing if any of it is damaged.
+func readSnapshot(name string) (snapshotCopy, error) {
+	var snapshot snapshotCopy
+
+	file, err := os.Open(name)
+	if err != nil {
+		return snapshot, fmt.Errorf("opening snapshot: %w", err)
+	}
+
+	defer func() {
+		_ = file.Close()
+	}()
+
+	reader := bufio.NewReader(file)
+
+	if _, err = readFrame(reader, &snapshot.header); err != nil {
+		return snapshot, err
+	}
+
+	snapshot.entries = make([]snapshotEntry, 0, snapshot.header.Count)
+
+	for {
+		var entry snapshotEntry
+
+		if _, err = readFrame(reader, &entry); err != nil {
+			break
+		}
+
+		snapshot.entries = append(snapshot.entries, entry)
+	}
+
+	if !errors.Is(err, io.EOF) {
+		return snapshot, err
+	}
+
+	if len(snapshot.entries) != snapshot.header.Count {
+		return snapshot, errSnapshotLength
+	}
+
+	return snapshot, nil
+}
+
+// newestSnapshot returns the most recent snapshot in dir that can be read in
+// full, reporting any newer ones that could not through warn.
+func newestSnapshot(dir string, warn func(string)) (snapshotCopy, bool, error) {
+	found, err := sequencedFiles(dir, snapshotPrefix, snapshotSuffix)
+	if err != nil {
+		return snapshotCopy{}, false, err
+	}
+
+	for i := len(found) - 1; i >= 0; i-- {
+		name := filepath.Join(dir, snapshotName(found[i]))
+
+		snapshot, readErr := readSnapshot(name)
+		if readErr == nil {
+			return snapshot, true, nil
+		}
+
+		warn(fmt.Sprintf("Skipping snapshot %s: %v", name, readErr))
+	}
+
+	return snapshotCopy{}, false, nil
+}
+
+// pruneSnapshots removes all but the newest retain snapshots, returning the
+// sequence number of the oldest one kept.
+func pruneSnapshots(dir string, retain int) (uint64, error) {
+	found, err := sequencedFiles(dir, snapshotPrefix, snapshotSuffix)
+	if err != nil || len(found) == 0 {
+		return 0, err
+	}
+
+	if retain < 1 {
+		retain = 1
+	}
+
+	for len(found) > retain {
+		if err = os.Remove(filepath.Join(dir, snapshotName(found[0]))); err != nil {
+			return 0, fmt.Errorf("removing snapshot: %w", err)
+		}
+
+		found = found[1:]
+	}
+
+	return found[0], nil
+}
+
+// Snapshot writes every entry in the store to a new snapshot in the data
+// directory. Writes are only held up while the entries are copied, not while
+// they are written out.
+func (s *Store) Snapshot() error {
+	if s.log == nil {
+		return ErrNoDataDir
+	}
+
+	s.snapshotMutex.Lock()
+	defer s.snapshotMutex.Unlock()
+
+	resume := s.pause()
+	snapshot := s.copySnapshot()
+	resume()
+
+	return s.saveSnapshot(snapshot)
+}
+
+// copySnapshot copies the store and rotates the write-ahead log so the
+// records after the copy are kept apart from those before it. The shards
+// must not be running transactions.
+func (s *Store) copySnapshot() snapshotCopy {
+	var entries []snapshotEntry
+
+	for _, sh := range s.shards {
+		for key, value := range sh.value {
+			entries = append(entries, snapshotEntry{Key: key, Entry: value})
+		}
+	}
+
+	// keys are restored in timestamp order so this is least recently used
+	// across the whole store, even if restored into a different number of
+	// shards
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Entry.Timestamp < entries[j].Entry.Timestamp
+	})
+
+	return snapshotCopy{
+		header: snapshotHeader{
+			Seq:       s.seq,
+			Count:     len(entries),
+			Created:   time.Now().UnixNano(),
+			Quotas:    s.quotas.copyOverrides(),
+			Transfers: s.transfers.copyEntries(),
+			Groups:    s.groups.copyMembers(),
+		},
+		entries: entries,
+		err:     s.log.rotate(s.seq),
+	}
+}
+
+// saveSnapshot writes out a copy then removes the snapshots and rotated logs
+// that are no longer needed.
+func (s *Store) saveSnapshot(snapshot snapshotCopy) error {
+	if snapshot.err != nil {
+		return snapshot.err
+	}
+
+	if err := writeSnapshot(s.dataDir, snapshot); err != nil {
+		return err
+	}
+
+	oldest, err := pruneSnapshots(s.dataDir, s.snapshotRetain)
+	if err != nil {
+		return err
+	}
+
+	return s.log.prune(oldest)
+}
+
+// snapshotEvery takes a snapshot on interval until the store is closed.
+func (s *Store) snapshotEvery(interval time.Duration) {
+	defer close(s.snapshotDone)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.Snapshot(); err != nil {
+				s.warn(fmt.Sprintf("Error taking snapshot %v", err))
+			}
+		case <-s.snapshotStop:
+			return
+		}
+	}
+}
+
+// restore loads the newest snapshot in the data directory and replays the
+// write-ahead log written after it.
+func (s *Store) restore(opts Options) error {
+	if err := os.MkdirAll(opts.DataDir, dataDirMode); err != nil {
+		return fmt.Errorf("creating data directory: %w", err)
+	}
+
+	snapshot, ok, err := newestSnapshot(opts.DataDir, s.warn)
+	if err != nil {
+		return err
+	}
+
+	if ok {
+		for _, entry := range snapshot.entries {
+			entry := entry
+			s.shardFor(entry.Key).apply(walRecord{Op: walUpsert, Key: entry.Key, Entry: &entry.Entry})
+		}
+
+		for user, quota := range snapshot.header.Quotas {
+			quota := quota
+			s.quotas.override(user, &quota)
+		}
+
+		s.transfers.entries = snapshot.header.Transfers
+
+		for name, members := range snapshot.header.Groups {
+			s.groups.set(name, members)
+		}
+
+		s.seq = snapshot.header.Seq
+	}
+
+	s.log, err = openWAL(opts.DataDir, opts.Sync, opts.SyncInterval, s.replay, s.warn)
+
+	return err
+}
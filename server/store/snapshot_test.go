@@ -0,0 +1,167 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestStore(t, Options{DataDir: dir, Depth: 3})
+
+	<-s.Upsert("key1", "user1", "value1")
+	<-s.Upsert("key2", "user2", "value2")
+	<-s.Upsert("key3", "user1", "value3")
+	<-s.Fetch("key1")
+
+	if err := s.Snapshot(); err != nil {
+		t.Fatalf("Expected no error taking snapshot but got %v", err)
+	}
+
+	// written after the snapshot so only in the log
+	<-s.Upsert("key3", "user1", "value3-amended")
+	s.Close()
+
+	s = openTestStore(t, Options{DataDir: dir, Depth: 3})
+	defer s.Close()
+
+	response := <-s.Fetch("key1")
+
+	val, ok := response.(DataValue)
+	if !ok {
+		t.Fatalf("Expected a DataValue structure back from fetch but got %v", response)
+	}
+
+	if val.Owner != "user1" || val.Reads != 2 || val.Writes != 1 {
+		t.Errorf("Expected key1 counters to be restored but got %+v", val)
+	}
+
+	if val, _ = (<-s.Fetch("key3")).(DataValue); val.Value != "value3-amended" {
+		t.Errorf("Expected key3 to be value3-amended but got %s", val.Value)
+	}
+
+	// key2 is least recently used once restored
+	<-s.Upsert("key4", "user1", "value4")
+
+	if response = <-s.Fetch("key2"); response != nil {
+		t.Errorf("Expected key2 to be evicted but got %v", response)
+	}
+}
+
+func TestSnapshotFallsBackToOlder(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestStore(t, Options{DataDir: dir})
+
+	<-s.Upsert("key1", "user1", "value1")
+
+	if err := s.Snapshot(); err != nil {
+		t.Fatalf("Expected no error taking snapshot but got %v", err)
+	}
+
+	<-s.Upsert("key2", "user1", "value2")
+	s.Close()
+
+	found, err := sequencedFiles(dir, snapshotPrefix, snapshotSuffix)
+	if err != nil || len(found) != 2 {
+		t.Fatalf("Expected 2 snapshots but got %v, %v", found, err)
+	}
+
+	newest := filepath.Join(dir, snapshotName(found[1]))
+	if err = os.WriteFile(newest, []byte("corrupt"), dataFileMode); err != nil {
+		t.Fatal(err)
+	}
+
+	var warnings []string
+
+	s = openTestStore(t, Options{DataDir: dir, Warn: func(w string) { warnings = append(warnings, w) }})
+	defer s.Close()
+
+	if len(warnings) != 1 {
+		t.Errorf("Expected a warning about the corrupt snapshot but got %v", warnings)
+	}
+
+	for _, key := range []string{"key1", "key2"} {
+		if _, ok := (<-s.Fetch(key)).(DataValue); !ok {
+			t.Errorf("Expected %s to be restored", key)
+		}
+	}
+}
+
+func TestSnapshotRetention(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestStore(t, Options{DataDir: dir, SnapshotRetain: 2})
+
+	for _, key := range []string{"key1", "key2", "key3", "key4"} {
+		<-s.Upsert(key, "user1", "value")
+
+		if err := s.Snapshot(); err != nil {
+			t.Fatalf("Expected no error taking snapshot but got %v", err)
+		}
+	}
+
+	s.Close()
+
+	found, _ := sequencedFiles(dir, snapshotPrefix, snapshotSuffix)
+	if len(found) != 2 || found[1] != 4 {
+		t.Errorf("Expected the 2 newest snapshots to be kept but got %v", found)
+	}
+
+	rotated, _ := segments(dir)
+	for _, seq := range rotated {
+		if seq <= found[0] {
+			t.Errorf("Expected log segment %d to be pruned", seq)
+		}
+	}
+}
+
+func TestSnapshotInterval(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestStore(t, Options{DataDir: dir, SnapshotInterval: 10 * time.Millisecond})
+	defer s.Close()
+
+	<-s.Upsert("key1", "user1", "value1")
+
+	deadline := time.Now().Add(time.Second)
+
+	for time.Now().Before(deadline) {
+		if found, _ := sequencedFiles(dir, snapshotPrefix, snapshotSuffix); len(found) > 0 && found[0] == 1 {
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Error("Expected a snapshot to be taken on the interval")
+}
+
+func TestSnapshotWithoutDataDir(t *testing.T) {
+	s := openTestStore(t, Options{})
+	defer s.Close()
+
+	if err := s.Snapshot(); err != ErrNoDataDir {
+		t.Errorf("Expected ErrNoDataDir but got %v", err)
+	}
+}
+
+func TestSnapshotChangeShards(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestStore(t, Options{DataDir: dir, Shards: 4})
+
+	keys := []string{"key1", "key2", "key3", "key4", "key5", "key6"}
+	for _, key := range keys {
+		<-s.Upsert(key, "user1", "value")
+	}
+
+	s.Close()
+
+	s = openTestStore(t, Options{DataDir: dir, Shards: 3})
+	defer s.Close()
+
+	for _, key := range keys {
+		if _, ok := (<-s.Fetch(key)).(DataValue); !ok {
+			t.Errorf("Expected %s to be restored", key)
+		}
+	}
+}
@@ -3,6 +3,9 @@ package store
 
 import (
 	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
 	"time"
 )
 
@@ -12,10 +15,19 @@ var ErrNotFound = errors.New("key not found")
 // ErrForbidden is no access to key
 var ErrForbidden = errors.New("Forbidden")
 
+// ErrStoreFull is no room for a new key that could be made by eviction.
+var ErrStoreFull = errors.New("store full")
+
+// ErrNoDataDir is an attempt to persist a store without a data directory.
+var ErrNoDataDir = errors.New("no data directory")
+
 const admin = "admin"
 
-// StoreDepth max number of values to retain in cache.
-var StoreDepth = 100
+// DefaultDepth max number of values to retain in cache when none is given.
+const DefaultDepth = 100
+
+// DefaultShards number of shards the keyspace is split over when none is given.
+const DefaultShards = 1
 
 var userList = map[string]string{
 	"user_a": "passwordA",
@@ -24,292 +36,540 @@ var userList = map[string]string{
 	admin:    "Password1",
 }
 
-// DataValue struct stored in store.
+// DataValue struct stored in store. Version is the sequence number of the
+// change that last wrote the value so it only ever increases. Expires is when
+// the value expires in unix nanoseconds, zero if it never does. Pinned values
+// are never evicted. ACL holds the rights other users have been granted and
+// Offer the user the key has been offered to, if any. Writer and Modified are
+// who last wrote the value and when, unlike Timestamp which reads update too.
+// History holds previous versions, HistoryLimit overriding how many are kept.
+// The value may hold any bytes, ContentType and ContentEncoding describing
+// them if they were given when written.
 type DataValue struct {
-	Owner     string `json:"owner"`
-	Value     string `json:"value"`
-	Timestamp int64  `json:"timestamp"`
-	Writes    int
-	Reads     int
+	Owner           string     `json:"owner"`
+	Value           string     `json:"value"`
+	ContentType     string     `json:"content_type,omitempty"`
+	ContentEncoding string     `json:"content_encoding,omitempty"`
+	Timestamp       int64      `json:"timestamp"`
+	Version         uint64     `json:"version"`
+	Expires         int64      `json:"expires,omitempty"`
+	Pinned          bool       `json:"pinned,omitempty"`
+	ACL             ACL        `json:"acl,omitempty"`
+	Offer           string     `json:"offer,omitempty"`
+	Writer          string     `json:"writer,omitempty"`
+	Modified        int64      `json:"modified,omitempty"`
+	History         []Revision `json:"history,omitempty"`
+	HistoryLimit    *int       `json:"history_limit,omitempty"`
+	Writes          int
+	Reads           int
 }
 
-// ListValue struct for returning key info.
+// ListValue struct for returning key info. Size is the length of the value in
+// bytes and Age milliseconds since the key was last used.
+// ExpiresIn is milliseconds until the key expires, absent if it never does.
+// ACL is only given to the owner and admin, Offer also to the user the key
+// has been offered to.
 type ListValue struct {
-	Key    string `json:"key"`
-	Owner  string `json:"owner"`
-	Writes int    `json:"writes"`
-	Reads  int    `json:"reads"`
-	Age    int64  `json:"age"`
+	Key       string `json:"key"`
+	Owner     string `json:"owner"`
+	Writes    int    `json:"writes"`
+	Reads     int    `json:"reads"`
+	Size      int    `json:"size"`
+	Age       int64  `json:"age"`
+	ExpiresIn *int64 `json:"expires_in,omitempty"`
+	Pinned    bool   `json:"pinned"`
+	ACL       ACL    `json:"acl,omitempty"`
+	Offer     string `json:"offer,omitempty"`
 }
 
-// ListRequest struct for returning channel of list objects.
+// ListRequest struct for returning channel of list objects. Without a Key
+// the keys in Range matching Query are listed.
 type ListRequest struct {
 	Key      string
 	Owner    string
+	Range    KeyRange
+	Query    ListQuery
 	Response chan []ListValue
 }
 
-// FetchRequest response of a fetch.
+// FetchRequest response of a fetch. If Owner is set the key is only returned
+// if they may read it. If Version is set that version is returned, if it is
+// still kept, without counting as a read.
 type FetchRequest struct {
 	Key      string
+	Owner    string
+	Version  uint64
 	Response chan interface{}
 }
 
 // UpsertRequest message to send to get update.
+// A TTL gives the key a new expiry, otherwise an update keeps the expiry the
+// key already has unless ClearTTL is set. A new key is owned by Group, if
+// set, which Owner must belong to. HistoryLimit sets how many previous
+// versions of the key are kept. If Restore is set Value is ignored and the
+// version given is written again instead. ContentType and ContentEncoding
+// describe the value.
 type UpsertRequest struct {
-	Key      string
-	Value    string
-	Owner    string
-	Response chan interface{}
+	Key             string
+	Value           string
+	ContentType     string
+	ContentEncoding string
+	Owner           string
+	Group           string
+	HistoryLimit    *int
+	Restore         uint64
+	Condition       Precondition
+	TTL             time.Duration
+	ClearTTL        bool
+	Response        chan interface{}
 }
 
 // DeleteRequest to signal delete.
 type DeleteRequest struct {
-	Key      string
-	Owner    string
-	Response chan interface{}
+	Key       string
+	Owner     string
+	Condition Precondition
+	Response  chan interface{}
+}
+
+// doneRequest to signal done.
+type doneRequest struct {
 }
 
-// DoneRequest to signal done.
-type DoneRequest struct {
+// Options used to configure a new store.
+type Options struct {
+	// Depth max number of values to retain, DefaultDepth if not set.
+	Depth int
+	// Shards number of shards to split the keyspace over, DefaultShards if not set.
+	Shards int
+	// ShardDepth max number of values in each shard, an even split of Depth if
+	// not set.
+	ShardDepth int
+	// DataDir directory for the write-ahead log, no persistence if not set.
+	DataDir string
+	// Sync when the write-ahead log is flushed to disk.
+	Sync SyncPolicy
+	// SyncInterval how often a SyncBatched log is flushed.
+	SyncInterval time.Duration
+	// SnapshotInterval how often to snapshot the store, only on Close if not set.
+	SnapshotInterval time.Duration
+	// SnapshotRetain snapshots to keep, DefaultSnapshotRetain if not set.
+	SnapshotRetain int
+	// MaxBytes memory the entries may use, see entrySize, no limit if not set.
+	MaxBytes int64
+	// MaxValueSize largest value in bytes that may be written, no limit if not
+	// set.
+	MaxValueSize int64
+	// History previous versions of each key to keep, none if not set.
+	History int
+	// Quota for each owner unless admin sets another, no limit if not set.
+	Quota Quota
+	// Retention how long versions are kept for reads as of an earlier time,
+	// DefaultRetention if not set.
+	Retention time.Duration
+	// ChangeBuffer how many recent changes are kept for the change feed,
+	// DefaultChangeBuffer if not set.
+	ChangeBuffer int
+	// PinnedFraction of Depth that may be pinned, DefaultPinnedFraction if not
+	// set.
+	PinnedFraction float64
+	// Policy creates the eviction policy for each shard, least recently used
+	// if not set.
+	Policy NewPolicy
+	// Warn receives problems the store recovered from, ignored if not set.
+	Warn func(string)
 }
 
-// Store struct to hold the map and access channels.
+// Store struct to hold the shards and what they share.
 type Store struct {
-	value         map[string]DataValue
-	upsertChannel chan UpsertRequest
-	deleteChannel chan DeleteRequest
-	fetchChannel  chan FetchRequest
-	listChannel   chan ListRequest
+	shards         []*shard
+	depth          int
+	count          int64
+	bytes          int64
+	maxBytes       int64
+	maxValueSize   int64
+	history        int
+	pinned         int64
+	maxPinned      int64
+	quotas         *quotas
+	groups         *groups
+	transfers      transferLog
+	versions       *mvcc
+	watchers       *watchers
+	changes        *changeRing
+	commitMutex    sync.Mutex
+	seq            uint64
+	log            *wal
+	dataDir        string
+	snapshotRetain int
+	snapshotMutex  sync.Mutex
+	snapshotStop   chan struct{}
+	snapshotDone   chan struct{}
+	warn           func(string)
+	closeOnce      sync.Once
 }
 
-// Upsert amend an entry in the store.
-func (s *Store) Upsert(key, owner, value string) chan interface{} {
-	responseChannel := make(chan interface{})
-	s.upsertChannel <- UpsertRequest{Key: key, Owner: owner, Value: value, Response: responseChannel}
+// New creates a store and starts the goroutines monitoring it. If a data
+// directory is given the store is restored from it first. Close must be
+// called to stop the goroutines once the store is no longer needed.
+func New(opts Options) (*Store, error) {
+	depth := opts.Depth
+	if depth <= 0 {
+		depth = DefaultDepth
+	}
 
-	return responseChannel
-}
+	shards := opts.Shards
+	if shards <= 0 {
+		shards = DefaultShards
+	}
 
-// Delete remove an entry from the store.
-func (s *Store) Delete(key, owner string) chan interface{} {
-	responseChannel := make(chan interface{})
-	s.deleteChannel <- DeleteRequest{Key: key, Owner: owner, Response: responseChannel}
+	// by default split the depth evenly, rounding up so it is all used
+	shardDepth := opts.ShardDepth
+	if shardDepth <= 0 {
+		shardDepth = (depth + shards - 1) / shards
+	}
 
-	return responseChannel
-}
+	warn := opts.Warn
+	if warn == nil {
+		warn = func(string) {}
+	}
 
-// Fetch gets an entry from the store using the give key.
-func (s *Store) Fetch(key string) chan interface{} {
-	responseChannel := make(chan interface{})
-	s.fetchChannel <- FetchRequest{Key: key, Response: responseChannel}
+	s := &Store{
+		shards:         make([]*shard, shards),
+		depth:          depth,
+		maxBytes:       opts.MaxBytes,
+		maxValueSize:   opts.MaxValueSize,
+		history:        opts.History,
+		quotas:         newQuotas(opts.Quota),
+		groups:         newGroups(),
+		versions:       newMVCC(opts.Retention),
+		watchers:       newWatchers(),
+		changes:        newChangeRing(opts.ChangeBuffer),
+		dataDir:        opts.DataDir,
+		snapshotRetain: opts.SnapshotRetain,
+		snapshotStop:   make(chan struct{}),
+		snapshotDone:   make(chan struct{}),
+		warn:           warn,
+	}
 
-	return responseChannel
-}
+	newPolicy := opts.Policy
+	if newPolicy == nil {
+		newPolicy = func(int) Policy { return newLRUPolicy() }
+	}
 
-// List gets key/owner for all keys.
-func (s *Store) List(owner string) chan []ListValue {
-	responseChannel := make(chan []ListValue)
-	s.listChannel <- ListRequest{Owner: owner, Key: "", Response: responseChannel}
+	for i := range s.shards {
+		s.shards[i] = newShard(s, shardDepth, newPolicy(shardDepth))
+	}
 
-	return responseChannel
-}
+	pinnedFraction := opts.PinnedFraction
+	if pinnedFraction <= 0 || pinnedFraction > 1 {
+		pinnedFraction = DefaultPinnedFraction
+	}
 
-// ListForKey gets key/owner for specific key.
-func (s *Store) ListForKey(key, owner string) chan []ListValue {
-	responseChannel := make(chan []ListValue)
-	s.listChannel <- ListRequest{Owner: owner, Key: key, Response: responseChannel}
+	s.maxPinned = int64(pinnedFraction * float64(depth))
 
-	return responseChannel
-}
+	if s.maxBytes < 0 {
+		s.maxBytes = 0
+	}
+
+	if s.snapshotRetain <= 0 {
+		s.snapshotRetain = DefaultSnapshotRetain
+	}
 
-func lru(m *map[string]DataValue) string {
-	var oldestKey string
+	if opts.DataDir != "" {
+		if err := s.restore(opts); err != nil {
+			return nil, err
+		}
 
-	now := time.Now().UnixNano()
+		s.versions.load(s.shards, s.seq)
+		s.changes.reset(s.seq)
 
-	for k, v := range *m {
-		if v.Timestamp < now {
-			oldestKey = k
-			now = v.Timestamp
+		if err := s.trim(); err != nil {
+			_ = s.log.close()
+			return nil, err
 		}
 	}
 
-	return oldestKey
-}
+	for _, sh := range s.shards {
+		sh.start()
+	}
 
-// Done channel.
-var Done = make(chan DoneRequest)
-
-// Monitor checks for store transaction messages and acts accordingly.
-func (s *Store) Monitor() {
-	go transactionMonitor()
-
-	loop := true
-
-	for loop {
-		select {
-		case value := <-s.upsertChannel:
-			transactionChannel <- value
-		case listreq := <-s.listChannel:
-			transactionChannel <- listreq
-		case freq := <-s.fetchChannel:
-			transactionChannel <- freq
-		case dreq := <-s.deleteChannel:
-			transactionChannel <- dreq
-		case req := <-Done:
-			transactionChannel <- req
-
-			loop = false
-		}
+	go s.versions.collectEvery()
+
+	if opts.DataDir != "" && opts.SnapshotInterval > 0 {
+		go s.snapshotEvery(opts.SnapshotInterval)
+	} else {
+		close(s.snapshotDone)
 	}
+
+	return s, nil
 }
 
-var transactionChannel = make(chan interface{})
+// Close stops the store goroutines and waits for them to finish. A persisted
+// store takes a final snapshot. The store must not be used once closed.
+func (s *Store) Close() {
+	s.closeOnce.Do(func() {
+		close(s.snapshotStop)
+		<-s.snapshotDone
 
-func transactionMonitor() {
-	for {
-		transaction := <-transactionChannel
+		close(s.versions.stop)
+		<-s.versions.done
 
-		if _, ok := transaction.(DoneRequest); ok {
-			break
-		}
-		// upsert transaction
-		if msg, ok := transaction.(UpsertRequest); ok {
-			transactionUpsert(msg)
-			continue
+		s.watchers.dropAll()
+
+		for _, sh := range s.shards {
+			sh.stop()
 		}
-		// delete transaction
-		if msg, ok := transaction.(DeleteRequest); ok {
-			transactionDelete(msg)
-			continue
+
+		if s.log == nil {
+			return
 		}
-		// fetcj transaction
-		if msg, ok := transaction.(FetchRequest); ok {
-			transactionFetch(msg)
-			continue
+
+		// nothing else can touch the store now so it can be copied directly
+		if err := s.saveSnapshot(s.copySnapshot()); err != nil {
+			s.warn(fmt.Sprintf("Error taking snapshot %v", err))
 		}
-		// list transactiom
-		if msg, ok := transaction.(ListRequest); ok {
-			transactionList(msg)
-			continue
+
+		if err := s.log.close(); err != nil {
+			s.warn(fmt.Sprintf("Error closing store %v", err))
 		}
+	})
+}
+
+// shardFor returns the shard holding key.
+func (s *Store) shardFor(key string) *shard {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(key))
+
+	return s.shards[hash.Sum32()%uint32(len(s.shards))]
+}
+
+// pause holds every shard between transactions, in order so that two pauses
+// cannot each be waiting on a shard the other holds. The returned function
+// lets them continue.
+func (s *Store) pause() func() {
+	resume := make(chan struct{})
+
+	for _, sh := range s.shards {
+		sh.pause(resume)
 	}
+
+	return func() { close(resume) }
 }
 
-func transactionDelete(msg DeleteRequest) {
-	if entry, ok := internalStore[msg.Key]; ok {
-		if entry.Owner == msg.Owner || msg.Owner == admin {
-			delete(internalStore, msg.Key)
-			msg.Response <- nil
-		} else {
-			msg.Response <- ErrForbidden
+// replay applies a record read back from the write-ahead log, skipping any
+// already included in the snapshot the store was restored from.
+func (s *Store) replay(record walRecord) {
+	if record.Seq <= s.seq {
+		return
+	}
+
+	switch record.Op {
+	case walBatch:
+		for _, change := range record.Batch {
+			s.apply(change)
 		}
-	} else {
-		msg.Response <- ErrNotFound
+	case walQuota:
+		s.quotas.override(record.Key, record.Quota)
+	case walGroup:
+		s.groups.set(record.Key, record.Members)
+	default:
+		s.apply(record)
 	}
+
+	s.seq = record.Seq
 }
 
-func transactionUpsert(msg UpsertRequest) {
-	storeFull := len(internalStore) >= StoreDepth
-
-	if current, ok := internalStore[msg.Key]; ok {
-		// trying to update
-		if msg.Owner != current.Owner && msg.Owner != admin {
-			msg.Response <- ErrForbidden
-		} else {
-			internalStore[msg.Key] = DataValue{
-				Owner:     current.Owner,
-				Value:     msg.Value,
-				Timestamp: time.Now().UnixNano(),
-				Writes:    current.Writes + 1,
-				Reads:     current.Reads,
+// apply a change to a key replayed from the write-ahead log.
+func (s *Store) apply(record walRecord) {
+	s.shardFor(record.Key).apply(record)
+
+	if record.Transfer != nil {
+		s.transfers.add(*record.Transfer)
+	}
+}
+
+// trim evicts keys until every shard and the store as a whole are within
+// their depths and memory budget, used after restoring as they may have been
+// lowered.
+func (s *Store) trim() error {
+	for _, sh := range s.shards {
+		s.count += int64(len(sh.value))
+
+		for key, value := range sh.value {
+			s.bytes += sh.size(key)
+
+			if value.Pinned {
+				s.pinned++
 			}
-			msg.Response <- nil
+
+			s.quotas.hold(value)
 		}
-	} else {
-		// inserting
-		if storeFull {
-			oldestKey := lru(&internalStore)
-			delete(internalStore, oldestKey)
+	}
+
+	for _, sh := range s.shards {
+		for len(sh.value) > sh.depth {
+			if err := sh.evict(); err != nil {
+				return err
+			}
 		}
+	}
 
-		internalStore[msg.Key] = DataValue{
-			Owner:     msg.Owner,
-			Value:     msg.Value,
-			Timestamp: time.Now().UnixNano(),
-			Writes:    1,
-			Reads:     0,
+	for s.count > int64(s.depth) || s.overBudget() {
+		oldest := s.oldestVictim()
+		if oldest == nil {
+			return ErrStoreFull
+		}
+
+		if err := oldest.evict(); err != nil {
+			return err
 		}
-		msg.Response <- nil
 	}
+
+	return nil
 }
 
-func transactionFetch(msg FetchRequest) {
-	val, ok := internalStore[msg.Key]
-	if ok {
-		msg.Response <- val
-		val.Reads++
-		val.Timestamp = time.Now().UnixNano()
-		internalStore[msg.Key] = val
-	} else {
-		msg.Response <- nil
+// oldestVictim returns the shard whose policy's victim was least recently
+// used, nil if no shard has one. Every shard must be paused, or not yet
+// started.
+func (s *Store) oldestVictim() *shard {
+	var (
+		oldest     *shard
+		oldestTime int64
+	)
+
+	for _, sh := range s.shards {
+		if key, ok := sh.policy.Victim(); ok && (oldest == nil || sh.value[key].Timestamp < oldestTime) {
+			oldest, oldestTime = sh, sh.value[key].Timestamp
+		}
 	}
+
+	return oldest
 }
 
-func transactionList(msg ListRequest) {
-	var responseList []ListValue
-
-	if msg.Key == "" {
-		// look at all keys and add them if they belong to owner or if owner = admin
-		for key, element := range internalStore {
-			if element.Owner == msg.Owner || msg.Owner == admin {
-				responseList = append(responseList, ListValue{
-					Key:    key,
-					Owner:  element.Owner,
-					Writes: element.Writes,
-					Reads:  element.Reads,
-					Age:    age(element.Timestamp)})
-			}
+// commit writes a change to the write-ahead log, if there is one, before it
+// is applied. Reads only update the counters in memory, they are persisted
+// with the next write to the key. Shards commit one at a time so the log is
+// always in sequence order.
+func (s *Store) commit(record walRecord) error {
+	s.commitMutex.Lock()
+	defer s.commitMutex.Unlock()
+
+	record.Seq = s.seq + 1
+	record.setVersion()
+
+	if s.log != nil {
+		if err := s.log.append(s.logged(record)); err != nil {
+			return err
 		}
-		msg.Response <- responseList
+	}
 
-		return
+	s.seq = record.Seq
+	events := s.events([]walRecord{record})
+	s.versions.publish(record)
+	s.checkRetained()
+	s.changes.add(events, s.seq)
+	s.watchers.notify(events)
+
+	return nil
+}
+
+// commitBatch writes changes to the write-ahead log as a single record so they
+// are replayed together or not at all.
+func (s *Store) commitBatch(records []walRecord) error {
+	if len(records) == 0 {
+		return nil
 	}
 
-	val, ok := internalStore[msg.Key]
-	if ok {
-		// found the specific key, add it if belongs to owner or owner is admin
-		if val.Owner == msg.Owner || msg.Owner == admin {
-			responseList = append(responseList, ListValue{
-				Key:    msg.Key,
-				Owner:  val.Owner,
-				Writes: val.Writes,
-				Reads:  val.Reads,
-				Age:    age(val.Timestamp)})
+	s.commitMutex.Lock()
+	defer s.commitMutex.Unlock()
+
+	seq := s.seq
+
+	for i := range records {
+		seq++
+		records[i].Seq = seq
+		records[i].setVersion()
+	}
+
+	if s.log != nil {
+		if err := s.log.append(s.logged(walRecord{Seq: seq, Op: walBatch, Batch: records})); err != nil {
+			return err
 		}
 	}
 
-	msg.Response <- responseList
+	s.seq = seq
+	events := s.events(records)
+	s.versions.publish(records...)
+	s.checkRetained()
+	s.changes.add(events, s.seq)
+	s.watchers.notify(events)
+
+	return nil
+}
+
+// Upsert amend an entry in the store. The response is the stored DataValue or
+// an error.
+func (s *Store) Upsert(key, owner, value string) chan interface{} {
+	return s.UpsertWith(UpsertRequest{Key: key, Owner: owner, Value: value})
+}
+
+// UpsertWith amend an entry in the store as described by req, the response
+// channel is filled in.
+func (s *Store) UpsertWith(req UpsertRequest) chan interface{} {
+	req.Response = make(chan interface{})
+	s.shardFor(req.Key).upsertChannel <- req
+
+	return req.Response
+}
+
+// Delete remove an entry from the store.
+func (s *Store) Delete(key, owner string) chan interface{} {
+	return s.DeleteWith(DeleteRequest{Key: key, Owner: owner})
+}
+
+// DeleteWith remove an entry from the store as described by req, the response
+// channel is filled in.
+func (s *Store) DeleteWith(req DeleteRequest) chan interface{} {
+	req.Response = make(chan interface{})
+	s.shardFor(req.Key).deleteChannel <- req
+
+	return req.Response
+}
+
+// Fetch gets an entry from the store using the give key.
+func (s *Store) Fetch(key string) chan interface{} {
+	return s.FetchWith(FetchRequest{Key: key})
+}
+
+// FetchWith gets an entry from the store as described by req, the response
+// channel is filled in.
+func (s *Store) FetchWith(req FetchRequest) chan interface{} {
+	req.Response = make(chan interface{})
+	s.shardFor(req.Key).fetchChannel <- req
+
+	return req.Response
 }
 
-var internalStore = make(map[string]DataValue)
-var upsertChannel = make(chan UpsertRequest)
-var deleteChannel = make(chan DeleteRequest)
-var fetchChannel = make(chan FetchRequest)
-var listChannel = make(chan ListRequest)
-
-// PublicAccess creates a new store to be used.
-var PublicAccess = Store{
-	value:         internalStore,
-	upsertChannel: upsertChannel,
-	deleteChannel: deleteChannel,
-	fetchChannel:  fetchChannel,
-	listChannel:   listChannel,
+// List gets key/owner for all keys in order, asking every shard and merging
+// the results.
+func (s *Store) List(owner string) chan []ListValue {
+	page := s.Scan(owner, KeyRange{}, ListQuery{})
+	responseChannel := make(chan []ListValue)
+
+	go func() {
+		responseChannel <- (<-page).Keys
+	}()
+
+	return responseChannel
 }
 
-func age(since int64) int64 {
-	return time.Now().UnixNano()/int64(time.Millisecond) - since
+// ListForKey gets key/owner for specific key.
+func (s *Store) ListForKey(key, owner string) chan []ListValue {
+	responseChannel := make(chan []ListValue)
+	s.shardFor(key).listChannel <- ListRequest{Owner: owner, Key: key, Response: responseChannel}
+
+	return responseChannel
 }
 
 // ValidateLogin check usename and password is valid in list of users.
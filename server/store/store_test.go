@@ -28,49 +28,79 @@ func TestValidatLogin(t *testing.T) {
 	})
 }
 
-func TestInsert(t *testing.T) {
-	go store.PublicAccess.Monitor()
-	t.Run("Insert", func(t *testing.T) {
-		go store.PublicAccess.Monitor()
-		response := <-store.PublicAccess.Upsert("key0", "admin", "should be pushed off")
-		if response != nil {
-			t.Errorf("expected no error but got %v", response)
-		}
-		response = <-store.PublicAccess.Upsert("key1", "user1", "value1")
-		if response != nil {
-			t.Errorf("expected no error but got %v", response)
-		}
-		response = <-store.PublicAccess.Upsert("key2", "user2", "value2")
-		if response != nil {
-			t.Errorf("expected no error but got %v", response)
-		}
-		response = <-store.PublicAccess.Upsert("key3", "user1", "value3")
-		if response != nil {
-			t.Errorf("expected no error but got %v", response)
-		}
-		response = <-store.PublicAccess.Upsert("key4", "user2", "value4")
-		if response != nil {
-			t.Errorf("expected no error but got %v", response)
-		}
-		response = <-store.PublicAccess.Upsert("key5", "user1", "value5")
-		if response != nil {
-			t.Errorf("expected no error but got %v", response)
-		}
-		response = <-store.PublicAccess.Upsert("key6", "user3", "value6")
-		if response != nil {
+// isError reports whether a store response is an error rather than a value.
+func isError(response interface{}) bool {
+	_, ok := response.(error)
+	return ok
+}
+
+func newTestStore(t *testing.T, depth int) *store.Store {
+	t.Helper()
+
+	s, err := store.New(store.Options{Depth: depth})
+	if err != nil {
+		t.Fatalf("Expected no error creating store but got %v", err)
+	}
+
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// populate inserts key0 to key6 owned by a mix of users.
+func populate(t *testing.T, s *store.Store) {
+	t.Helper()
+
+	entries := []struct{ key, owner, value string }{
+		{"key0", "admin", "should be pushed off"},
+		{"key1", "user1", "value1"},
+		{"key2", "user2", "value2"},
+		{"key3", "user1", "value3"},
+		{"key4", "user2", "value4"},
+		{"key5", "user1", "value5"},
+		{"key6", "user3", "value6"},
+	}
+
+	for _, e := range entries {
+		response := <-s.Upsert(e.key, e.owner, e.value)
+		if isError(response) {
 			t.Errorf("expected no error but got %v", response)
 		}
+	}
+}
+
+func TestInsert(t *testing.T) {
+	t.Run("Insert", func(t *testing.T) {
+		populate(t, newTestStore(t, store.DefaultDepth))
 	})
 }
 
+func TestIndependentStores(t *testing.T) {
+	first := newTestStore(t, store.DefaultDepth)
+	second := newTestStore(t, store.DefaultDepth)
+
+	response := <-first.Upsert("key1", "user1", "value1")
+	if isError(response) {
+		t.Errorf("expected no error but got %v", response)
+	}
+
+	response = <-second.Fetch("key1")
+	if response != nil {
+		t.Errorf("Expected key1 to be missing from second store but got %v", response)
+	}
+}
+
 func TestUpdateAndFetchReadAndWrites(t *testing.T) {
+	s := newTestStore(t, store.DefaultDepth)
+	populate(t, s)
+
 	t.Run("Update", func(t *testing.T) {
-		response := <-store.PublicAccess.Upsert("key1", "user1", "value1-amended By User")
-		if response != nil {
+		response := <-s.Upsert("key1", "user1", "value1-amended By User")
+		if isError(response) {
 			t.Errorf("Expected nil on insert but got %v", response)
 		}
 
-		response = <-store.PublicAccess.Fetch("key1")
+		response = <-s.Fetch("key1")
 		val, ok := response.(store.DataValue)
 		if !ok {
 			t.Errorf("Expected a DataValue structure back from fetch but got %v", response)
@@ -78,12 +108,12 @@ func TestUpdateAndFetchReadAndWrites(t *testing.T) {
 			t.Errorf("Expected value to be value1-amended By User but got %s", val.Value)
 		}
 
-		response = <-store.PublicAccess.Upsert("key1", "admin", "value1-amended By Admin")
-		if response != nil {
+		response = <-s.Upsert("key1", "admin", "value1-amended By Admin")
+		if isError(response) {
 			t.Errorf("Expected nil on insert but got %v", response)
 		}
 
-		response = <-store.PublicAccess.Fetch("key1")
+		response = <-s.Fetch("key1")
 		val, ok = response.(store.DataValue)
 		if !ok {
 			t.Errorf("Expected a DataValue structure back from fetch but got %v", response)
@@ -102,21 +132,24 @@ func TestUpdateAndFetchReadAndWrites(t *testing.T) {
 }
 
 func TestCheckDelete(t *testing.T) {
+	s := newTestStore(t, store.DefaultDepth)
+	populate(t, s)
+
 	t.Run("Delete", func(t *testing.T) {
 		// now attempt to delete a key we do not own - not admin
-		response := <-store.PublicAccess.Delete("key6", "user1")
+		response := <-s.Delete("key6", "user1")
 		if response == nil {
 			t.Errorf("Expected response to be forbidden but got %v", response)
 		}
 
 		// attempt to delete a key we do not own - admin
-		response = <-store.PublicAccess.Delete("key6", "admin")
+		response = <-s.Delete("key6", "admin")
 		if response != nil {
 			t.Errorf("Expected response to be nil but got %v", response)
 		}
 
 		// attempt to delete a key we do own
-		response = <-store.PublicAccess.Delete("key5", "user1")
+		response = <-s.Delete("key5", "user1")
 		if response != nil {
 			t.Errorf("Expected response to be nil but got %v", response)
 		}
@@ -125,31 +158,63 @@ func TestCheckDelete(t *testing.T) {
 
 func TestLRUCapability(t *testing.T) {
 	var maxentries = 5
-	store.StoreDepth = maxentries
+
+	s := newTestStore(t, maxentries)
+	populate(t, s)
+
 	t.Run("lru", func(t *testing.T) {
-		response := <-store.PublicAccess.Upsert("key7", "admin", "value7")
-		if response != nil {
+		response := <-s.Upsert("key7", "admin", "value7")
+		if isError(response) {
 			t.Errorf("expected no error but got %v", response)
 		}
 
 		// now try and get key0 - should be gone
-		response = <-store.PublicAccess.Fetch("key0")
+		response = <-s.Fetch("key0")
+		if response != nil {
+			t.Errorf("Expected response to be nil but got %v", response)
+		}
+
+		// key2 was the oldest left after populating so should have gone too
+		response = <-s.Fetch("key2")
 		if response != nil {
 			t.Errorf("Expected response to be nil but got %v", response)
 		}
+
+		response = <-s.Fetch("key3")
+		if _, ok := response.(store.DataValue); !ok {
+			t.Errorf("Expected a DataValue structure back from fetch but got %v", response)
+		}
 	})
 }
 
+// listStore is populated then has key5 and key6 removed, leaving key0 to key4.
+func listStore(t *testing.T) *store.Store {
+	t.Helper()
+
+	s := newTestStore(t, store.DefaultDepth)
+	populate(t, s)
+
+	for _, key := range []string{"key5", "key6"} {
+		if response := <-s.Delete(key, "admin"); response != nil {
+			t.Errorf("Expected response to be nil but got %v", response)
+		}
+	}
+
+	return s
+}
+
 func TestList(t *testing.T) {
+	s := listStore(t)
+
 	t.Run("Basic", func(t *testing.T) {
-		response := <-store.PublicAccess.List("user1")
+		response := <-s.List("user1")
 		if len(response) != 2 {
 			t.Errorf("Expected 2 entries for user1 but got %d", len(response))
 		}
 	})
 
 	t.Run("Admin", func(t *testing.T) {
-		response := <-store.PublicAccess.List("admin")
+		response := <-s.List("admin")
 		if len(response) != 5 {
 			t.Errorf("Expected 5 entries for admin but got %d", len(response))
 		}
@@ -157,26 +222,26 @@ func TestList(t *testing.T) {
 }
 
 func TestListKey(t *testing.T) {
+	s := listStore(t)
+
 	t.Run("Basic", func(t *testing.T) {
-		response := <-store.PublicAccess.ListForKey("key3", "user1")
+		response := <-s.ListForKey("key3", "user1")
 		if len(response) != 1 {
 			t.Errorf("Expected 1 entries for user1 key3 but got %d", len(response))
 		}
 	})
 
 	t.Run("BasicMissing", func(t *testing.T) {
-		response := <-store.PublicAccess.ListForKey("key4", "user1")
+		response := <-s.ListForKey("key4", "user1")
 		if len(response) != 0 {
 			t.Errorf("Expected 0 entries for user1 key4 but got %d", len(response))
 		}
 	})
 
 	t.Run("Admin", func(t *testing.T) {
-		response := <-store.PublicAccess.ListForKey("key3", "admin")
+		response := <-s.ListForKey("key3", "admin")
 		if len(response) != 1 {
 			t.Errorf("Expected 1 entries for admin but got %d", len(response))
 		}
 	})
-
-	store.Done <- store.DoneRequest{}
 }
@@ -0,0 +1,270 @@
+package store
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultTransferHistory number of transfers remembered.
+const DefaultTransferHistory = 1000
+
+// ErrNoOffer is accepting a key that has not been offered to the caller.
+var ErrNoOffer = errors.New("no offer")
+
+// ErrBadTransfer is a transfer that cannot be made, such as one to nobody.
+var ErrBadTransfer = errors.New("bad transfer")
+
+// Transfer a change of owner, By being the new owner accepting an offer or
+// admin reassigning the key. Version is the key's version after the change.
+type Transfer struct {
+	Key       string `json:"key"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+	By        string `json:"by"`
+	Timestamp int64  `json:"timestamp"`
+	Version   uint64 `json:"version"`
+}
+
+// transferOp what a transferRequest does.
+type transferOp int
+
+const (
+	transferOffer transferOp = iota
+	transferAccept
+	transferReassign
+)
+
+// transferRequest offers a key to To, accepts an offer of it or has admin
+// reassign it to To.
+type transferRequest struct {
+	Op       transferOp
+	Key      string
+	Owner    string
+	To       string
+	Response chan interface{}
+}
+
+// transferLog the most recent transfers, oldest first.
+type transferLog struct {
+	mutex   sync.Mutex
+	entries []Transfer
+}
+
+func (l *transferLog) add(transfer Transfer) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.entries = append(l.entries, transfer)
+
+	if extra := len(l.entries) - DefaultTransferHistory; extra > 0 {
+		l.entries = append([]Transfer(nil), l.entries[extra:]...)
+	}
+}
+
+func (l *transferLog) copyEntries() []Transfer {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return append([]Transfer(nil), l.entries...)
+}
+
+// Offer offers key to another user who becomes its owner once they accept,
+// an empty to withdrawing the offer. Only the owner or admin may. The
+// response is the updated DataValue or an error.
+func (s *Store) Offer(key, owner, to string) chan interface{} {
+	return s.sendTransfer(transferRequest{Op: transferOffer, Key: key, Owner: owner, To: to})
+}
+
+// Accept makes user the owner of a key that was offered to them, or their
+// group the owner of a key offered to it. The response is the updated
+// DataValue or an error.
+func (s *Store) Accept(key, user string) chan interface{} {
+	return s.sendTransfer(transferRequest{Op: transferAccept, Key: key, Owner: user})
+}
+
+// Reassign makes to the owner of key straight away, only admin may. The new
+// owner's quota is not checked. The response is the updated DataValue or an
+// error.
+func (s *Store) Reassign(key, caller, to string) chan interface{} {
+	return s.sendTransfer(transferRequest{Op: transferReassign, Key: key, Owner: caller, To: to})
+}
+
+func (s *Store) sendTransfer(req transferRequest) chan interface{} {
+	req.Response = make(chan interface{})
+	s.shardFor(req.Key).transferChannel <- req
+
+	return req.Response
+}
+
+// ReassignAll makes to the owner of every key from owns, atomically, and
+// returns how many there were. Only admin may. As with Reassign the new
+// owner's quota is not checked.
+func (s *Store) ReassignAll(caller, from, to string) (int, error) {
+	if caller != admin {
+		return 0, ErrForbidden
+	}
+
+	if from == "" || to == "" {
+		return 0, ErrBadTransfer
+	}
+
+	if from == to {
+		return 0, nil
+	}
+
+	resume := s.pause()
+	defer resume()
+
+	view := &txnView{store: s, now: time.Now().UnixNano(), changed: make(map[string]*DataValue)}
+	changes := make(map[string]usage)
+
+	var records []walRecord
+
+	for _, sh := range s.shards {
+		for key, current := range sh.value {
+			if current.Owner != from || current.expired(view.now) {
+				continue
+			}
+
+			current := current
+			value := current.transferred(to)
+			transfer := Transfer{Key: key, From: from, To: to, By: caller, Timestamp: view.now}
+
+			view.set(key, &value)
+			addChange(changes, &current, &value)
+			records = append(records, walRecord{Op: walUpsert, Key: key, Entry: &value, Transfer: &transfer})
+		}
+	}
+
+	s.quotas.apply(changes)
+
+	if err := s.commitBatch(records); err != nil {
+		s.quotas.refund(changes)
+		return 0, err
+	}
+
+	s.applyView(view, s.shards)
+
+	for _, record := range records {
+		s.transfers.add(*record.Transfer)
+	}
+
+	return len(records), nil
+}
+
+// Transfers returns the recent transfers caller was part of, every one of
+// them for admin, oldest first.
+func (s *Store) Transfers(caller string) []Transfer {
+	var transfers []Transfer
+
+	for _, transfer := range s.transfers.copyEntries() {
+		if caller == admin || transfer.From == caller || transfer.To == caller {
+			transfers = append(transfers, transfer)
+		}
+	}
+
+	return transfers
+}
+
+// transferred returns a copy of the value owned by to, any offer withdrawn
+// and any grant to the new owner dropped as they no longer need it.
+func (d DataValue) transferred(to string) DataValue {
+	d.Owner = to
+	d.Offer = ""
+
+	if _, ok := d.ACL[to]; ok {
+		d.ACL = d.ACL.with(to, Grant{})
+	}
+
+	return d
+}
+
+func (sh *shard) transactionTransfer(msg transferRequest) {
+	value, ok := sh.lookup(msg.Key)
+	who := sh.store.identify(msg.Owner)
+
+	switch {
+	case !ok:
+		msg.Response <- ErrNotFound
+		return
+	case msg.Op == transferAccept && (value.Offer == "" || !who.is(value.Offer)):
+		msg.Response <- ErrNoOffer
+		return
+	case msg.Op == transferOffer && !value.manages(who),
+		msg.Op == transferReassign && msg.Owner != admin:
+		msg.Response <- ErrForbidden
+		return
+	case msg.Op == transferOffer && msg.To == value.Owner,
+		msg.Op == transferReassign && msg.To == "":
+		msg.Response <- ErrBadTransfer
+		return
+	case msg.Op == transferOffer && msg.To == value.Offer,
+		msg.Op == transferReassign && msg.To == value.Owner:
+		msg.Response <- value
+		return
+	}
+
+	if msg.Op == transferOffer {
+		value.Offer = msg.To
+
+		if err := sh.put(msg.Key, &value); err != nil {
+			msg.Response <- err
+			return
+		}
+
+		msg.Response <- value
+
+		return
+	}
+
+	// a key offered to a group is accepted by any member for the group
+	to := msg.To
+	if msg.Op == transferAccept {
+		to = value.Offer
+	}
+
+	updated := value.transferred(to)
+
+	// the new owner accepting is held to their quota, admin is not
+	changes := make(map[string]usage)
+	addChange(changes, &value, &updated)
+
+	if msg.Op == transferAccept {
+		if err := sh.store.quotas.charge(changes); err != nil {
+			msg.Response <- err
+			return
+		}
+	} else {
+		sh.store.quotas.apply(changes)
+	}
+
+	transfer := Transfer{Key: msg.Key, From: value.Owner, To: to, By: msg.Owner, Timestamp: time.Now().UnixNano()}
+
+	if err := sh.reown(msg.Key, &updated, &transfer); err != nil {
+		sh.store.quotas.refund(changes)
+		msg.Response <- err
+
+		return
+	}
+
+	msg.Response <- updated
+}
+
+// reown commits and stores a key's value under its new owner and records the
+// transfer. The owner's name counts towards the size of an entry so the
+// memory used is updated, but nothing is evicted for a change this small.
+func (sh *shard) reown(key string, value *DataValue, transfer *Transfer) error {
+	delta := entrySize(key, *value) - sh.size(key)
+
+	if err := sh.store.commit(walRecord{Op: walUpsert, Key: key, Entry: value, Transfer: transfer}); err != nil {
+		return err
+	}
+
+	atomic.AddInt64(&sh.store.bytes, delta)
+	sh.set(key, *value)
+	sh.store.transfers.add(*transfer)
+
+	return nil
+}
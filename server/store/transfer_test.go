@@ -0,0 +1,103 @@
+package store
+
+import (
+	"testing"
+)
+
+func TestOfferAndAccept(t *testing.T) {
+	s := openTestStore(t, Options{Depth: DefaultDepth, Quota: Quota{Keys: 1}})
+	defer s.Close()
+
+	<-s.Upsert("key1", "user1", "value")
+	<-s.GrantAccess("key1", "user1", "user2", Grant{Read: true})
+
+	if response := <-s.Accept("key1", "user2"); response != ErrNoOffer {
+		t.Errorf("Expected accepting without an offer to fail but got %v", response)
+	}
+
+	if response := <-s.Offer("key1", "user2", "user2"); response != ErrForbidden {
+		t.Errorf("Expected only the owner to offer a key but got %v", response)
+	}
+
+	<-s.Offer("key1", "user1", "user2")
+
+	if list := <-s.ListForKey("key1", "user2"); len(list) != 1 || list[0].Offer != "user2" {
+		t.Errorf("Expected the offer to be listed for the recipient but got %v", list)
+	}
+
+	if response := <-s.Accept("key1", "user3"); response != ErrNoOffer {
+		t.Errorf("Expected only the recipient to accept but got %v", response)
+	}
+
+	response := <-s.Accept("key1", "user2")
+
+	value, ok := response.(DataValue)
+	if !ok || value.Owner != "user2" || value.Offer != "" || value.ACL != nil {
+		t.Fatalf("Expected user2 to own the key with no offer or grant left but got %v", response)
+	}
+
+	if usage, _ := s.Usage(admin, "user1"); usage.Keys != 0 {
+		t.Errorf("Expected the key to move off user1's quota but got %v", usage)
+	}
+
+	<-s.Upsert("key2", "user1", "value")
+	<-s.Offer("key2", "user1", "user2")
+
+	if response = <-s.Accept("key2", "user2"); response != ErrQuotaExceeded {
+		t.Errorf("Expected accepting over quota to fail but got %v", response)
+	}
+
+	transfers := s.Transfers("user1")
+	if len(transfers) != 1 || transfers[0].By != "user2" || transfers[0].Version != value.Version {
+		t.Errorf("Expected the transfer to be recorded but got %v", transfers)
+	}
+
+	if transfers = s.Transfers("user3"); len(transfers) != 0 {
+		t.Errorf("Expected other users not to see the transfer but got %v", transfers)
+	}
+}
+
+func TestReassign(t *testing.T) {
+	dir := t.TempDir()
+
+	s := openTestStore(t, Options{Depth: DefaultDepth, Shards: 4, DataDir: dir})
+
+	for _, key := range []string{"key1", "key2", "key3"} {
+		<-s.Upsert(key, "user1", "value")
+	}
+
+	<-s.Upsert("key4", "user2", "value")
+
+	if response := <-s.Reassign("key4", "user2", "user3"); response != ErrForbidden {
+		t.Errorf("Expected only admin to reassign but got %v", response)
+	}
+
+	if value, ok := (<-s.Reassign("key4", admin, "user3")).(DataValue); !ok || value.Owner != "user3" {
+		t.Errorf("Expected admin to reassign key4 but got %v", value)
+	}
+
+	if _, err := s.ReassignAll("user1", "user1", "user3"); err != ErrForbidden {
+		t.Errorf("Expected only admin to reassign in bulk but got %v", err)
+	}
+
+	if count, err := s.ReassignAll(admin, "user1", "user3"); count != 3 || err != nil {
+		t.Errorf("Expected 3 keys to be reassigned but got %d, %v", count, err)
+	}
+
+	s.Close()
+
+	s = openTestStore(t, Options{Depth: DefaultDepth, Shards: 2, DataDir: dir})
+	defer s.Close()
+
+	if list := <-s.List("user3"); len(list) != 4 {
+		t.Errorf("Expected user3 to own every key after restoring but got %v", list)
+	}
+
+	if usage, _ := s.Usage(admin, "user3"); usage.Keys != 4 {
+		t.Errorf("Expected user3's usage to be restored but got %v", usage)
+	}
+
+	if transfers := s.Transfers(admin); len(transfers) != 4 {
+		t.Errorf("Expected every transfer to be restored but got %v", transfers)
+	}
+}
@@ -0,0 +1,391 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// ErrConditionFailed is a transaction condition that did not hold.
+var ErrConditionFailed = errors.New("condition failed")
+
+// ErrBadTransaction is a transaction that cannot be run as written.
+var ErrBadTransaction = errors.New("bad transaction")
+
+// Transaction operations.
+const (
+	TxnPut    = "put"
+	TxnDelete = "delete"
+	TxnGet    = "get"
+)
+
+// TxnCondition must hold before a transaction is applied, fields that are not
+// set are not checked.
+type TxnCondition struct {
+	Key     string  `json:"key"`
+	Exists  *bool   `json:"exists,omitempty"`
+	Version *uint64 `json:"version,omitempty"`
+	Owner   *string `json:"owner,omitempty"`
+}
+
+// TxnOperation is a put, delete or get run as part of a transaction.
+type TxnOperation struct {
+	Op    string `json:"op"`
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+}
+
+// TxnRequest a set of conditions and the operations to run if they all hold.
+type TxnRequest struct {
+	Owner      string         `json:"-"`
+	Conditions []TxnCondition `json:"conditions"`
+	Operations []TxnOperation `json:"operations"`
+}
+
+// TxnResult the outcome of an operation, Found only being set for a get.
+type TxnResult struct {
+	Op      string `json:"op"`
+	Key     string `json:"key"`
+	Version uint64 `json:"version,omitempty"`
+	Value   string `json:"value,omitempty"`
+	Found   *bool  `json:"found,omitempty"`
+}
+
+// TxnFailure the first condition or operation that stopped a transaction.
+type TxnFailure struct {
+	Index     int           `json:"index"`
+	Condition *TxnCondition `json:"condition,omitempty"`
+	Operation *TxnOperation `json:"operation,omitempty"`
+	Error     string        `json:"error"`
+}
+
+// TxnResponse results for every operation if the transaction was applied,
+// otherwise Err and the reason nothing was applied.
+type TxnResponse struct {
+	Results []TxnResult `json:"results,omitempty"`
+	Failed  *TxnFailure `json:"failed,omitempty"`
+	Err     error       `json:"-"`
+}
+
+// Transaction checks every condition then applies every operation, or nothing
+// at all. The shards holding the keys involved are paused so the transaction
+// sees and changes them at a single point in time.
+func (s *Store) Transaction(req TxnRequest) chan TxnResponse {
+	responseChannel := make(chan TxnResponse)
+
+	go func() {
+		involved := s.shardsFor(req)
+		resume := make(chan struct{})
+
+		for _, sh := range involved {
+			sh.pause(resume)
+		}
+
+		response := s.transact(req, involved)
+
+		close(resume)
+
+		responseChannel <- response
+	}()
+
+	return responseChannel
+}
+
+// shardsFor returns the shards holding any key in req in store order.
+func (s *Store) shardsFor(req TxnRequest) []*shard {
+	indexes := make(map[*shard]int, len(s.shards))
+	for i, sh := range s.shards {
+		indexes[sh] = i
+	}
+
+	seen := make(map[*shard]bool)
+
+	var involved []*shard
+
+	add := func(key string) {
+		if sh := s.shardFor(key); !seen[sh] {
+			seen[sh] = true
+			involved = append(involved, sh)
+		}
+	}
+
+	for _, c := range req.Conditions {
+		add(c.Key)
+	}
+
+	for _, op := range req.Operations {
+		add(op.Key)
+	}
+
+	sort.Slice(involved, func(i, j int) bool { return indexes[involved[i]] < indexes[involved[j]] })
+
+	return involved
+}
+
+// txnView is the store as a transaction's operations have left it so far.
+// Keys that have expired by now are treated as missing.
+type txnView struct {
+	store   *Store
+	now     int64
+	changed map[string]*DataValue
+	order   []string
+}
+
+func (v *txnView) get(key string) (*DataValue, bool) {
+	if value, ok := v.changed[key]; ok {
+		return value, value != nil
+	}
+
+	if value, ok := v.store.shardFor(key).value[key]; ok && !value.expired(v.now) {
+		return &value, true
+	}
+
+	return nil, false
+}
+
+func (v *txnView) set(key string, value *DataValue) {
+	if _, ok := v.changed[key]; !ok {
+		v.order = append(v.order, key)
+	}
+
+	v.changed[key] = value
+}
+
+// transact runs a transaction against shards that are already paused.
+func (s *Store) transact(req TxnRequest, involved []*shard) TxnResponse {
+	view := &txnView{store: s, now: time.Now().UnixNano(), changed: make(map[string]*DataValue)}
+	who := s.identify(req.Owner)
+
+	for i := range req.Conditions {
+		condition := req.Conditions[i]
+		current, ok := view.get(condition.Key)
+
+		if !condition.holds(current, ok) {
+			return TxnResponse{
+				Err:    ErrConditionFailed,
+				Failed: &TxnFailure{Index: i, Condition: &condition, Error: ErrConditionFailed.Error()},
+			}
+		}
+	}
+
+	results := make([]*DataValue, len(req.Operations))
+	changes := make(map[string]usage)
+
+	var records []walRecord
+
+	for i := range req.Operations {
+		op := req.Operations[i]
+		before, _ := view.get(op.Key)
+
+		record, result, err := view.run(op, who)
+		if err == nil {
+			after, _ := view.get(op.Key)
+			addChange(changes, before, after)
+			err = s.quotas.check(changes)
+		}
+
+		if err != nil {
+			return TxnResponse{Err: err, Failed: &TxnFailure{Index: i, Operation: &op, Error: err.Error()}}
+		}
+
+		if record != nil {
+			records = append(records, *record)
+		}
+
+		results[i] = result
+	}
+
+	// charged again in case another write for the same owners got in first
+	if err := s.quotas.charge(changes); err != nil {
+		return TxnResponse{Err: err}
+	}
+
+	if err := s.commitBatch(records); err != nil {
+		s.quotas.refund(changes)
+		return TxnResponse{Err: err}
+	}
+
+	s.applyView(view, involved)
+
+	return TxnResponse{Results: txnResults(req.Operations, results)}
+}
+
+// holds reports whether the condition is true of the current value of its key.
+func (c TxnCondition) holds(current *DataValue, exists bool) bool {
+	if c.Exists != nil && *c.Exists != exists {
+		return false
+	}
+
+	if c.Version != nil && (!exists || current.Version != *c.Version) {
+		return false
+	}
+
+	if c.Owner != nil && (!exists || current.Owner != *c.Owner) {
+		return false
+	}
+
+	return true
+}
+
+// run checks an operation is allowed under the usual access rules and
+// applies it to the view, returning the record to commit if it changes the
+// store and the value it leaves behind or read.
+func (v *txnView) run(op TxnOperation, who identity) (*walRecord, *DataValue, error) {
+	if op.Key == "" {
+		return nil, nil, ErrBadTransaction
+	}
+
+	current, ok := v.get(op.Key)
+
+	switch op.Op {
+	case TxnPut:
+		if ok && !current.allows(who, rightWrite) {
+			return nil, nil, ErrForbidden
+		}
+
+		if v.store.tooLarge(op.Value) {
+			return nil, nil, ErrTooLarge
+		}
+
+		now := time.Now().UnixNano()
+		value := &DataValue{
+			Owner:     who.user,
+			Value:     op.Value,
+			Timestamp: now,
+			Writer:    who.user,
+			Modified:  now,
+			Writes:    1,
+		}
+
+		if ok {
+			value.Owner = current.Owner
+			value.Writes = current.Writes + 1
+			value.Reads = current.Reads
+			value.Expires = current.Expires
+			value.Pinned = current.Pinned
+			value.ACL = current.ACL
+			value.Offer = current.Offer
+			value.HistoryLimit = current.HistoryLimit
+			value.History = current.revised(v.store.keep(*value))
+		}
+
+		if v.store.maxBytes > 0 && entrySize(op.Key, *value) > v.store.maxBytes {
+			return nil, nil, ErrTooLarge
+		}
+
+		v.set(op.Key, value)
+
+		return &walRecord{Op: walUpsert, Key: op.Key, Entry: value}, value, nil
+	case TxnDelete:
+		if !ok {
+			return nil, nil, ErrNotFound
+		}
+
+		if !current.allows(who, rightDelete) {
+			return nil, nil, ErrForbidden
+		}
+
+		v.set(op.Key, nil)
+
+		return &walRecord{Op: walDelete, Key: op.Key}, nil, nil
+	case TxnGet:
+		// only those who may read can, as with a plain get
+		if !ok || !current.allows(who, rightRead) {
+			return nil, nil, nil
+		}
+
+		// current is the view's own copy so the read can be counted in place,
+		// keeping it the value whose version is set when the batch commits
+		current.Reads++
+		current.Timestamp = time.Now().UnixNano()
+		v.set(op.Key, current)
+
+		return nil, current, nil
+	}
+
+	return nil, nil, ErrBadTransaction
+}
+
+// applyView stores the keys a transaction changed then evicts from the
+// shards involved until they and the store are back within their depths and
+// memory budget.
+func (s *Store) applyView(view *txnView, involved []*shard) {
+	for _, key := range view.order {
+		sh := s.shardFor(key)
+		value := view.changed[key]
+		previous, existed := sh.value[key]
+
+		atomic.AddInt64(&s.bytes, -sh.size(key))
+
+		if existed && previous.Pinned && (value == nil || !value.Pinned) {
+			atomic.AddInt64(&s.pinned, -1)
+		}
+
+		// an expired key the view treated as missing is still held
+		if existed && previous.expired(view.now) {
+			s.quotas.release(previous)
+		}
+
+		switch {
+		case value == nil && existed:
+			sh.unset(key)
+			sh.policy.Removed(key)
+			atomic.AddInt64(&s.count, -1)
+		case value != nil:
+			sh.set(key, *value)
+			atomic.AddInt64(&s.bytes, entrySize(key, *value))
+
+			if !existed {
+				atomic.AddInt64(&s.count, 1)
+			}
+		}
+	}
+
+	for _, sh := range involved {
+		for len(sh.value) > sh.depth {
+			if err := sh.evict(); err != nil {
+				s.warn(fmt.Sprintf("Error evicting after transaction %v", err))
+				return
+			}
+		}
+	}
+
+	for i := 0; (atomic.LoadInt64(&s.count) > int64(s.depth) || s.overBudget()) && i < len(involved); {
+		if len(involved[i].value) == 0 {
+			i++
+			continue
+		}
+
+		if err := involved[i].evict(); err != nil {
+			s.warn(fmt.Sprintf("Error evicting after transaction %v", err))
+			return
+		}
+	}
+}
+
+// txnResults builds the response for each operation once committed, when
+// the versions of the values they wrote are known.
+func txnResults(ops []TxnOperation, values []*DataValue) []TxnResult {
+	results := make([]TxnResult, len(ops))
+
+	for i, op := range ops {
+		results[i] = TxnResult{Op: op.Op, Key: op.Key}
+
+		switch op.Op {
+		case TxnPut:
+			results[i].Version = values[i].Version
+		case TxnGet:
+			found := values[i] != nil
+			results[i].Found = &found
+
+			if found {
+				results[i].Version = values[i].Version
+				results[i].Value = values[i].Value
+			}
+		}
+	}
+
+	return results
+}
@@ -0,0 +1,187 @@
+package store_test
+
+import (
+	"KeyValueStoreServer/server/store"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func boolPtr(b bool) *bool { return &b }
+
+func TestTransaction(t *testing.T) {
+	s := newShardedStore(t, store.Options{Shards: 4})
+	<-s.Upsert("pointer", "user1", "payload1")
+	<-s.Upsert("payload1", "user1", "old")
+	<-s.Upsert("other", "user2", "theirs")
+
+	t.Run("Applied", func(t *testing.T) {
+		response := <-s.Transaction(store.TxnRequest{
+			Owner:      "user1",
+			Conditions: []store.TxnCondition{{Key: "pointer", Exists: boolPtr(true)}},
+			Operations: []store.TxnOperation{
+				{Op: store.TxnPut, Key: "payload2", Value: "new"},
+				{Op: store.TxnPut, Key: "pointer", Value: "payload2"},
+				{Op: store.TxnDelete, Key: "payload1"},
+				{Op: store.TxnGet, Key: "pointer"},
+				{Op: store.TxnGet, Key: "other"},
+			},
+		})
+
+		if response.Err != nil || len(response.Results) != 5 {
+			t.Fatalf("Expected the transaction to apply but got %+v", response)
+		}
+
+		if read := response.Results[3]; !*read.Found || read.Value != "payload2" ||
+			read.Version != response.Results[1].Version {
+			t.Errorf("Expected get to see the put before it but got %+v", read)
+		}
+
+		if *response.Results[4].Found {
+			t.Error("Expected get of another user's key to not be found")
+		}
+
+		if response := <-s.Fetch("payload1"); response != nil {
+			t.Errorf("Expected payload1 to be deleted but got %v", response)
+		}
+
+		val, _ := (<-s.Fetch("pointer")).(store.DataValue)
+		if val.Value != "payload2" || val.Version != response.Results[1].Version || val.Reads != 2 {
+			t.Errorf("Expected pointer to be updated but got %+v", val)
+		}
+	})
+
+	t.Run("Condition failed", func(t *testing.T) {
+		version := uint64(1)
+		response := <-s.Transaction(store.TxnRequest{
+			Owner: "user1",
+			Conditions: []store.TxnCondition{
+				{Key: "pointer", Exists: boolPtr(true)},
+				{Key: "pointer", Version: &version},
+			},
+			Operations: []store.TxnOperation{{Op: store.TxnPut, Key: "untouched", Value: "value"}},
+		})
+
+		if response.Err != store.ErrConditionFailed || response.Failed == nil || response.Failed.Index != 1 {
+			t.Errorf("Expected the second condition to fail but got %+v", response)
+		}
+
+		if response := <-s.Fetch("untouched"); response != nil {
+			t.Errorf("Expected nothing to be applied but got %v", response)
+		}
+	})
+
+	t.Run("Operation failed", func(t *testing.T) {
+		response := <-s.Transaction(store.TxnRequest{
+			Owner: "user1",
+			Operations: []store.TxnOperation{
+				{Op: store.TxnPut, Key: "untouched", Value: "value"},
+				{Op: store.TxnPut, Key: "other", Value: "mine now"},
+			},
+		})
+
+		if response.Err != store.ErrForbidden || response.Failed == nil || response.Failed.Index != 1 {
+			t.Errorf("Expected the second operation to be forbidden but got %+v", response)
+		}
+
+		if response := <-s.Fetch("untouched"); response != nil {
+			t.Errorf("Expected nothing to be applied but got %v", response)
+		}
+	})
+
+	t.Run("Admin override", func(t *testing.T) {
+		owner := "user2"
+		response := <-s.Transaction(store.TxnRequest{
+			Owner:      "admin",
+			Conditions: []store.TxnCondition{{Key: "other", Owner: &owner}},
+			Operations: []store.TxnOperation{{Op: store.TxnPut, Key: "other", Value: "overridden"}},
+		})
+
+		if response.Err != nil {
+			t.Errorf("Expected admin to override but got %+v", response)
+		}
+
+		if val, _ := (<-s.Fetch("other")).(store.DataValue); val.Owner != "user2" || val.Value != "overridden" {
+			t.Errorf("Expected the value to change but not the owner, got %+v", val)
+		}
+	})
+
+	t.Run("Bad operation", func(t *testing.T) {
+		response := <-s.Transaction(store.TxnRequest{
+			Owner:      "user1",
+			Operations: []store.TxnOperation{{Op: "increment", Key: "pointer"}},
+		})
+
+		if response.Err != store.ErrBadTransaction {
+			t.Errorf("Expected a bad transaction but got %+v", response)
+		}
+	})
+}
+
+func TestTransactionReplay(t *testing.T) {
+	dir := t.TempDir()
+	s := newShardedStore(t, store.Options{DataDir: dir, Shards: 2})
+
+	response := <-s.Transaction(store.TxnRequest{
+		Owner: "user1",
+		Operations: []store.TxnOperation{
+			{Op: store.TxnPut, Key: "key1", Value: "value1"},
+			{Op: store.TxnPut, Key: "key2", Value: "value2"},
+			{Op: store.TxnDelete, Key: "key1"},
+		},
+	})
+	if response.Err != nil {
+		t.Fatalf("Expected the transaction to apply but got %+v", response)
+	}
+
+	s.Close()
+
+	s = newShardedStore(t, store.Options{DataDir: dir, Shards: 3})
+
+	if response := <-s.Fetch("key1"); response != nil {
+		t.Errorf("Expected key1 to stay deleted but got %v", response)
+	}
+
+	if val, _ := (<-s.Fetch("key2")).(store.DataValue); val.Version != response.Results[1].Version {
+		t.Errorf("Expected key2 at version %d but got %+v", response.Results[1].Version, val)
+	}
+}
+
+func TestTransactionConcurrent(t *testing.T) {
+	const workers = 8
+
+	s := newShardedStore(t, store.Options{Shards: 4, Depth: 10})
+
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+
+		go func(w int) {
+			defer wg.Done()
+
+			for i := 0; i < 20; i++ {
+				keys := []string{fmt.Sprintf("a%d", (w+i)%5), fmt.Sprintf("b%d", i%7)}
+
+				response := <-s.Transaction(store.TxnRequest{
+					Owner: "admin",
+					Operations: []store.TxnOperation{
+						{Op: store.TxnPut, Key: keys[0], Value: "value"},
+						{Op: store.TxnPut, Key: keys[1], Value: "value"},
+					},
+				})
+				if response.Err != nil {
+					t.Errorf("Expected the transaction to apply but got %+v", response)
+				}
+
+				<-s.Upsert(fmt.Sprintf("c%d-%d", w, i), "admin", "value")
+			}
+		}(w)
+	}
+
+	wg.Wait()
+
+	if list := <-s.List("admin"); len(list) > 10 {
+		t.Errorf("Expected the depth to be honoured but got %d keys", len(list))
+	}
+}
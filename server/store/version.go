@@ -0,0 +1,51 @@
+package store
+
+import "errors"
+
+// ErrPreconditionFailed is a conditional change to a key whose version did not
+// satisfy the condition.
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// VersionMatch is a set of versions a key may have, or any version at all.
+type VersionMatch struct {
+	Any      bool
+	Versions []uint64
+}
+
+// Matches reports whether version is in the set.
+func (m *VersionMatch) Matches(version uint64) bool {
+	if m.Any {
+		return true
+	}
+
+	for _, v := range m.Versions {
+		if v == version {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Precondition on the version of a key for a change to go ahead, nil fields
+// are not checked.
+type Precondition struct {
+	// IfMatch the key must exist with a matching version.
+	IfMatch *VersionMatch
+	// IfNoneMatch the key must not exist with a matching version.
+	IfNoneMatch *VersionMatch
+}
+
+// check the precondition against the current value of a key, exists being
+// false if there is no current value.
+func (p Precondition) check(current DataValue, exists bool) error {
+	if p.IfMatch != nil && (!exists || !p.IfMatch.Matches(current.Version)) {
+		return ErrPreconditionFailed
+	}
+
+	if p.IfNoneMatch != nil && exists && p.IfNoneMatch.Matches(current.Version) {
+		return ErrPreconditionFailed
+	}
+
+	return nil
+}
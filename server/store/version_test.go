@@ -0,0 +1,96 @@
+package store_test
+
+import (
+	"KeyValueStoreServer/server/store"
+	"testing"
+)
+
+func upsertVersion(t *testing.T, s *store.Store, req store.UpsertRequest) uint64 {
+	t.Helper()
+
+	response := <-s.UpsertWith(req)
+
+	val, ok := response.(store.DataValue)
+	if !ok {
+		t.Fatalf("Expected a DataValue structure back from upsert but got %v", response)
+	}
+
+	return val.Version
+}
+
+func TestVersions(t *testing.T) {
+	s := newTestStore(t, store.DefaultDepth)
+
+	first := upsertVersion(t, s, store.UpsertRequest{Key: "key1", Owner: "user1", Value: "value1"})
+	second := upsertVersion(t, s, store.UpsertRequest{Key: "key1", Owner: "user1", Value: "value2"})
+
+	if second <= first {
+		t.Errorf("Expected version to increase from %d but got %d", first, second)
+	}
+
+	val, _ := (<-s.Fetch("key1")).(store.DataValue)
+	if val.Version != second {
+		t.Errorf("Expected fetch to return version %d but got %d", second, val.Version)
+	}
+
+	<-s.Delete("key1", "user1")
+
+	if recreated := upsertVersion(t, s, store.UpsertRequest{Key: "key1", Owner: "user1"}); recreated <= second {
+		t.Errorf("Expected a recreated key to have a new version but got %d", recreated)
+	}
+}
+
+func TestPreconditions(t *testing.T) {
+	s := newTestStore(t, store.DefaultDepth)
+	version := upsertVersion(t, s, store.UpsertRequest{Key: "key1", Owner: "user1", Value: "value1"})
+
+	t.Run("If-Match", func(t *testing.T) {
+		response := <-s.UpsertWith(store.UpsertRequest{Key: "key1", Owner: "user1", Value: "stale",
+			Condition: store.Precondition{IfMatch: &store.VersionMatch{Versions: []uint64{version + 100}}}})
+		if response != store.ErrPreconditionFailed {
+			t.Errorf("Expected precondition failed but got %v", response)
+		}
+
+		version = upsertVersion(t, s, store.UpsertRequest{Key: "key1", Owner: "user1", Value: "fresh",
+			Condition: store.Precondition{IfMatch: &store.VersionMatch{Versions: []uint64{version}}}})
+
+		response = <-s.UpsertWith(store.UpsertRequest{Key: "missing", Owner: "user1",
+			Condition: store.Precondition{IfMatch: &store.VersionMatch{Any: true}}})
+		if response != store.ErrPreconditionFailed {
+			t.Errorf("Expected precondition failed for a missing key but got %v", response)
+		}
+	})
+
+	t.Run("If-None-Match", func(t *testing.T) {
+		createOnly := store.Precondition{IfNoneMatch: &store.VersionMatch{Any: true}}
+
+		response := <-s.UpsertWith(store.UpsertRequest{Key: "key1", Owner: "user1", Condition: createOnly})
+		if response != store.ErrPreconditionFailed {
+			t.Errorf("Expected create only to fail on an existing key but got %v", response)
+		}
+
+		upsertVersion(t, s, store.UpsertRequest{Key: "key2", Owner: "user1", Condition: createOnly})
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		response := <-s.DeleteWith(store.DeleteRequest{Key: "key1", Owner: "user1",
+			Condition: store.Precondition{IfMatch: &store.VersionMatch{Versions: []uint64{version - 1}}}})
+		if response != store.ErrPreconditionFailed {
+			t.Errorf("Expected precondition failed but got %v", response)
+		}
+
+		response = <-s.DeleteWith(store.DeleteRequest{Key: "key1", Owner: "user1",
+			Condition: store.Precondition{IfMatch: &store.VersionMatch{Versions: []uint64{version}}}})
+		if response != nil {
+			t.Errorf("Expected response to be nil but got %v", response)
+		}
+	})
+
+	t.Run("Forbidden before precondition", func(t *testing.T) {
+		response := <-s.UpsertWith(store.UpsertRequest{Key: "key2", Owner: "user2",
+			Condition: store.Precondition{IfMatch: &store.VersionMatch{Versions: []uint64{0}}}})
+		if response != store.ErrForbidden {
+			t.Errorf("Expected forbidden but got %v", response)
+		}
+	})
+}
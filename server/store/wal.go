@@ -0,0 +1,465 @@
+package store
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SyncPolicy controls when the write-ahead log is flushed to disk.
+type SyncPolicy int
+
+const (
+	// SyncAlways flushes the log after every record.
+	SyncAlways SyncPolicy = iota
+	// SyncBatched flushes the log on an interval.
+	SyncBatched
+	// SyncNever leaves flushing to the operating system.
+	SyncNever
+)
+
+// DefaultSyncInterval how often a batched log is flushed when none is given.
+const DefaultSyncInterval = 100 * time.Millisecond
+
+// ErrSyncPolicy is an unknown sync policy name.
+var ErrSyncPolicy = errors.New("unknown sync policy")
+
+// ErrLogFailed is a change refused because a failed write could not be
+// taken back out of the write-ahead log, so nothing more is appended to it.
+var ErrLogFailed = errors.New("write-ahead log failed")
+
+// ParseSyncPolicy converts always, batched or never to a SyncPolicy.
+func ParseSyncPolicy(name string) (SyncPolicy, error) {
+	switch name {
+	case "always":
+		return SyncAlways, nil
+	case "batched":
+		return SyncBatched, nil
+	case "never":
+		return SyncNever, nil
+	}
+
+	return SyncAlways, fmt.Errorf("%w: %s", ErrSyncPolicy, name)
+}
+
+const (
+	walFileName   = "store.wal"
+	dataDirMode   = 0700
+	dataFileMode  = 0600
+	frameHeader   = 8
+	decimalBase   = 10
+	sequenceWidth = 64
+	// frameMaxSize guards against reading a corrupt length as a huge frame.
+	frameMaxSize = 1 << 30
+)
+
+const (
+	walUpsert = "upsert"
+	walDelete = "delete"
+	walBatch  = "batch"
+	walQuota  = "quota"
+	walGroup  = "group"
+)
+
+var frameTable = crc32.MakeTable(crc32.Castagnoli)
+
+var errChecksum = errors.New("checksum mismatch")
+
+// walRecord a committed change to the store. A batch holds changes that must
+// all be replayed or not at all, its Seq being that of the last change. A
+// quota record sets the quota for the user in Key and a group record the
+// Members of the group in Key. An upsert changing the owner of a key carries
+// the Transfer. As logged an upsert keeping revisions the key's previous value
+// already held, as it or in its history, gives their Revisions by version in
+// place of the entry's history, so each write logs its value only once.
+type walRecord struct {
+	Seq       uint64      `json:"seq"`
+	Op        string      `json:"op"`
+	Key       string      `json:"key,omitempty"`
+	Entry     *DataValue  `json:"entry,omitempty"`
+	Revisions []uint64    `json:"revisions,omitempty"`
+	Batch     []walRecord `json:"batch,omitempty"`
+	Quota     *Quota      `json:"quota,omitempty"`
+	Transfer  *Transfer   `json:"transfer,omitempty"`
+	Members   []string    `json:"members,omitempty"`
+	cause     EventType
+}
+
+// setVersion gives the entry and transfer the record carries its sequence
+// number as their version.
+func (r *walRecord) setVersion() {
+	if r.Entry != nil {
+		r.Entry.Version = r.Seq
+	}
+
+	if r.Transfer != nil {
+		r.Transfer.Version = r.Seq
+	}
+}
+
+// writeFrame writes v as JSON preceded by a 4 byte length and 4 byte CRC of
+// the JSON. The log and snapshots are both made of frames.
+func writeFrame(w io.Writer, v interface{}) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encoding frame: %w", err)
+	}
+
+	buffer := make([]byte, frameHeader, frameHeader+len(payload))
+	binary.BigEndian.PutUint32(buffer[:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buffer[4:], crc32.Checksum(payload, frameTable))
+	buffer = append(buffer, payload...)
+
+	if _, err = w.Write(buffer); err != nil {
+		return fmt.Errorf("writing frame: %w", err)
+	}
+
+	return nil
+}
+
+// readFrame reads the next frame into v returning its size on disk. io.EOF is
+// only returned if there are no more frames.
+func readFrame(reader *bufio.Reader, v interface{}) (int64, error) {
+	header := make([]byte, frameHeader)
+
+	if _, err := io.ReadFull(reader, header); err != nil {
+		if errors.Is(err, io.EOF) {
+			return 0, io.EOF
+		}
+
+		return 0, fmt.Errorf("reading frame header: %w", err)
+	}
+
+	size := binary.BigEndian.Uint32(header[:4])
+	if size > frameMaxSize {
+		return 0, fmt.Errorf("frame length %d too large", size)
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return 0, fmt.Errorf("reading frame: %w", err)
+	}
+
+	if crc32.Checksum(payload, frameTable) != binary.BigEndian.Uint32(header[4:]) {
+		return 0, errChecksum
+	}
+
+	if err := json.Unmarshal(payload, v); err != nil {
+		return 0, fmt.Errorf("decoding frame: %w", err)
+	}
+
+	return int64(frameHeader) + int64(size), nil
+}
+
+// replayWAL applies every intact record in file and returns the offset after
+// the last one, along with the reason reading stopped early if the tail is
+// damaged.
+func replayWAL(file *os.File, apply func(walRecord)) (int64, error) {
+	reader := bufio.NewReader(file)
+
+	var offset int64
+
+	for {
+		var record walRecord
+
+		size, err := readFrame(reader, &record)
+		if errors.Is(err, io.EOF) {
+			return offset, nil
+		}
+
+		if err != nil {
+			return offset, err
+		}
+
+		apply(record)
+
+		offset += size
+	}
+}
+
+// segmentName is the name a log is given once rotated, seq being the last
+// record it can contain.
+func segmentName(seq uint64) string {
+	return fmt.Sprintf("%s.%020d", walFileName, seq)
+}
+
+// segments returns the rotated logs in dir oldest first, keyed by the last
+// sequence number they can contain.
+func segments(dir string) ([]uint64, error) {
+	return sequencedFiles(dir, walFileName+".", "")
+}
+
+// sequencedFiles finds files in dir named prefix, a sequence number, then
+// suffix and returns the sequence numbers in ascending order.
+func sequencedFiles(dir, prefix, suffix string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading data directory: %w", err)
+	}
+
+	var found []uint64
+
+	for _, entry := range entries {
+		name, ok := strings.CutPrefix(entry.Name(), prefix)
+		if !ok {
+			continue
+		}
+
+		if name, ok = strings.CutSuffix(name, suffix); !ok {
+			continue
+		}
+
+		if seq, parseErr := strconv.ParseUint(name, decimalBase, sequenceWidth); parseErr == nil {
+			found = append(found, seq)
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool { return found[i] < found[j] })
+
+	return found, nil
+}
+
+// wal is an append only log of committed changes.
+type wal struct {
+	mutex sync.Mutex
+	dir   string
+	file  *os.File
+	dirty bool
+	err   error
+	sync  SyncPolicy
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// openWAL replays any rotated logs in dir followed by the active log, then
+// opens the active log for appending. A torn or corrupt tail is truncated and
+// reported through warn.
+func openWAL(dir string, policy SyncPolicy, interval time.Duration, apply func(walRecord),
+	warn func(string)) (*wal, error) {
+	rotated, err := segments(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, seq := range rotated {
+		replaySegment(filepath.Join(dir, segmentName(seq)), apply, warn)
+	}
+
+	name := filepath.Join(dir, walFileName)
+
+	file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, dataFileMode)
+	if err != nil {
+		return nil, fmt.Errorf("opening write-ahead log: %w", err)
+	}
+
+	good, replayErr := replayWAL(file, apply)
+	if replayErr != nil {
+		warn(fmt.Sprintf("Truncating write-ahead log %s at offset %d: %v", name, good, replayErr))
+
+		if err = file.Truncate(good); err != nil {
+			_ = file.Close()
+			return nil, fmt.Errorf("truncating write-ahead log: %w", err)
+		}
+	}
+
+	if _, err = file.Seek(good, io.SeekStart); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("seeking write-ahead log: %w", err)
+	}
+
+	w := &wal{dir: dir, file: file, sync: policy, stop: make(chan struct{}), done: make(chan struct{})}
+
+	if policy == SyncBatched {
+		if interval <= 0 {
+			interval = DefaultSyncInterval
+		}
+
+		go w.syncEvery(interval)
+	} else {
+		close(w.done)
+	}
+
+	return w, nil
+}
+
+// replaySegment applies a rotated log. Rotated logs are never appended to
+// again so a damaged one is reported and left as it is.
+func replaySegment(name string, apply func(walRecord), warn func(string)) {
+	file, err := os.Open(name)
+	if err != nil {
+		warn(fmt.Sprintf("Skipping write-ahead log %s: %v", name, err))
+		return
+	}
+
+	defer func() {
+		_ = file.Close()
+	}()
+
+	if good, replayErr := replayWAL(file, apply); replayErr != nil {
+		warn(fmt.Sprintf("Ignoring write-ahead log %s after offset %d: %v", name, good, replayErr))
+	}
+}
+
+// append writes record to the log, flushing it if the policy is SyncAlways.
+// A record that fails to be written or flushed is taken back out of the log,
+// so neither a partial frame hides the records after it on replay nor a
+// refused change comes back. If it cannot be the log is failed, refusing
+// every later record.
+func (w *wal) append(record walRecord) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.err != nil {
+		return w.err
+	}
+
+	offset, err := w.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("checking write-ahead log: %w", err)
+	}
+
+	if err = writeFrame(w.file, record); err == nil && w.sync == SyncAlways {
+		if err = w.file.Sync(); err != nil {
+			err = fmt.Errorf("flushing write-ahead log: %w", err)
+		}
+	}
+
+	if err != nil {
+		return w.rollback(offset, err)
+	}
+
+	if w.sync != SyncAlways {
+		w.dirty = true
+	}
+
+	return nil
+}
+
+// rollback truncates the log back to offset after cause stopped a record
+// being appended, failing the log if it cannot. The mutex must be held.
+func (w *wal) rollback(offset int64, cause error) error {
+	if err := w.file.Truncate(offset); err != nil {
+		w.err = fmt.Errorf("%w: %v after %v", ErrLogFailed, err, cause)
+		return w.err
+	}
+
+	if _, err := w.file.Seek(offset, io.SeekStart); err != nil {
+		w.err = fmt.Errorf("%w: %v after %v", ErrLogFailed, err, cause)
+		return w.err
+	}
+
+	return cause
+}
+
+// rotate renames the active log after the last sequence number written to it
+// and starts a new one. An empty log is left as it is.
+func (w *wal) rotate(seq uint64) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	info, err := w.file.Stat()
+	if err != nil {
+		return fmt.Errorf("checking write-ahead log: %w", err)
+	}
+
+	if info.Size() == 0 {
+		return nil
+	}
+
+	if err = w.file.Sync(); err != nil {
+		return fmt.Errorf("flushing write-ahead log: %w", err)
+	}
+
+	active := filepath.Join(w.dir, walFileName)
+
+	if err = os.Rename(active, filepath.Join(w.dir, segmentName(seq))); err != nil {
+		return fmt.Errorf("rotating write-ahead log: %w", err)
+	}
+
+	file, err := os.OpenFile(active, os.O_RDWR|os.O_CREATE|os.O_TRUNC, dataFileMode)
+	if err != nil {
+		return fmt.Errorf("opening write-ahead log: %w", err)
+	}
+
+	_ = w.file.Close()
+	w.file = file
+	w.dirty = false
+
+	return nil
+}
+
+// prune removes rotated logs that only hold records up to seq.
+func (w *wal) prune(seq uint64) error {
+	rotated, err := segments(w.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, last := range rotated {
+		if last > seq {
+			break
+		}
+
+		if err = os.Remove(filepath.Join(w.dir, segmentName(last))); err != nil {
+			return fmt.Errorf("removing write-ahead log: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// syncEvery flushes the log on interval until the log is closed.
+func (w *wal) syncEvery(interval time.Duration) {
+	defer close(w.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.flush()
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+func (w *wal) flush() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.dirty {
+		_ = w.file.Sync()
+		w.dirty = false
+	}
+}
+
+// close flushes any outstanding records and closes the log.
+func (w *wal) close() error {
+	close(w.stop)
+	<-w.done
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.sync != SyncNever {
+		if err := w.file.Sync(); err != nil {
+			_ = w.file.Close()
+			return fmt.Errorf("flushing write-ahead log: %w", err)
+		}
+	}
+
+	return w.file.Close()
+}
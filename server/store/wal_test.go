@@ -0,0 +1,201 @@
+package store
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func openTestStore(t *testing.T, opts Options) *Store {
+	t.Helper()
+
+	s, err := New(opts)
+	if err != nil {
+		t.Fatalf("Expected no error opening store but got %v", err)
+	}
+
+	return s
+}
+
+// stored reports whether an upsert response is the value stored.
+func stored(response interface{}) bool {
+	_, ok := response.(DataValue)
+	return ok
+}
+
+func TestParseSyncPolicy(t *testing.T) {
+	policies := map[string]SyncPolicy{"always": SyncAlways, "batched": SyncBatched, "never": SyncNever}
+
+	for name, expected := range policies {
+		policy, err := ParseSyncPolicy(name)
+		if err != nil || policy != expected {
+			t.Errorf("Expected %s to parse to %d but got %d, %v", name, expected, policy, err)
+		}
+	}
+
+	if _, err := ParseSyncPolicy("sometimes"); err == nil {
+		t.Error("Expected an error parsing sometimes")
+	}
+}
+
+func TestWALReplay(t *testing.T) {
+	for _, policy := range []SyncPolicy{SyncAlways, SyncBatched, SyncNever} {
+		dir := t.TempDir()
+		s := openTestStore(t, Options{DataDir: dir, Sync: policy})
+
+		<-s.Upsert("key1", "user1", "value1")
+		<-s.Upsert("key1", "user1", "value1-amended")
+		<-s.Upsert("key2", "user2", "value2")
+		<-s.Upsert("key3", "user1", "value3")
+		<-s.Delete("key2", "user2")
+		s.Close()
+
+		s = openTestStore(t, Options{DataDir: dir, Sync: policy})
+
+		response := <-s.Fetch("key1")
+
+		val, ok := response.(DataValue)
+		if !ok {
+			t.Fatalf("Expected a DataValue structure back from fetch but got %v", response)
+		}
+
+		if val.Value != "value1-amended" || val.Owner != "user1" || val.Writes != 2 {
+			t.Errorf("Expected key1 to be replayed but got %+v", val)
+		}
+
+		if response = <-s.Fetch("key2"); response != nil {
+			t.Errorf("Expected deleted key2 to stay deleted but got %v", response)
+		}
+
+		if _, ok = (<-s.Fetch("key3")).(DataValue); !ok {
+			t.Error("Expected key3 to be replayed")
+		}
+
+		s.Close()
+	}
+}
+
+func TestWALReplayEvictions(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestStore(t, Options{DataDir: dir, Depth: 2})
+
+	<-s.Upsert("key1", "user1", "value1")
+	<-s.Upsert("key2", "user1", "value2")
+	<-s.Upsert("key3", "user1", "value3")
+	s.Close()
+
+	s = openTestStore(t, Options{DataDir: dir, Depth: 1})
+	defer s.Close()
+
+	if list := <-s.List(admin); len(list) != 1 || list[0].Key != "key3" {
+		t.Errorf("Expected only key3 after replay but got %v", list)
+	}
+}
+
+func TestWALTornTail(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestStore(t, Options{DataDir: dir})
+
+	<-s.Upsert("key1", "user1", "value1")
+	s.Close()
+
+	name := filepath.Join(dir, walFileName)
+
+	file, err := os.OpenFile(name, os.O_APPEND|os.O_WRONLY, dataFileMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _ = file.Write([]byte{0, 0, 0, 42, 1, 2, 3, 4, '{'})
+	_ = file.Close()
+
+	var warnings []string
+
+	s = openTestStore(t, Options{DataDir: dir, Warn: func(w string) { warnings = append(warnings, w) }})
+
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "Truncating") {
+		t.Errorf("Expected a truncation warning but got %v", warnings)
+	}
+
+	if _, ok := (<-s.Fetch("key1")).(DataValue); !ok {
+		t.Error("Expected key1 to survive a torn tail")
+	}
+
+	<-s.Upsert("key2", "user1", "value2")
+	s.Close()
+
+	warnings = nil
+	s = openTestStore(t, Options{DataDir: dir, Warn: func(w string) { warnings = append(warnings, w) }})
+	defer s.Close()
+
+	if len(warnings) != 0 {
+		t.Errorf("Expected no warnings after truncation but got %v", warnings)
+	}
+
+	if _, ok := (<-s.Fetch("key2")).(DataValue); !ok {
+		t.Error("Expected key2 written after truncation to be replayed")
+	}
+}
+
+func TestWALRollback(t *testing.T) {
+	dir := t.TempDir()
+
+	var replayed []string
+
+	w, err := openWAL(dir, SyncAlways, 0, func(walRecord) {}, func(string) {})
+	if err != nil {
+		t.Fatalf("Expected no error opening the log but got %v", err)
+	}
+
+	if err = w.append(walRecord{Seq: 1, Op: walDelete, Key: "key1"}); err != nil {
+		t.Fatalf("Expected no error appending but got %v", err)
+	}
+
+	// a record torn part way through is taken back out before the next
+	offset, _ := w.file.Seek(0, io.SeekCurrent)
+	_, _ = w.file.Write([]byte{0, 0, 1})
+
+	if err = w.rollback(offset, errors.New("short write")); err == nil || errors.Is(err, ErrLogFailed) {
+		t.Fatalf("Expected the write's own error back but got %v", err)
+	}
+
+	if err = w.append(walRecord{Seq: 2, Op: walDelete, Key: "key2"}); err != nil {
+		t.Fatalf("Expected no error appending after a rollback but got %v", err)
+	}
+
+	_ = w.close()
+
+	w, err = openWAL(dir, SyncAlways, 0, func(record walRecord) { replayed = append(replayed, record.Key) },
+		func(warning string) { t.Errorf("Expected an intact log but got %s", warning) })
+	if err != nil {
+		t.Fatalf("Expected no error reopening the log but got %v", err)
+	}
+
+	if strings.Join(replayed, ",") != "key1,key2" {
+		t.Errorf("Expected both records to be replayed but got %v", replayed)
+	}
+
+	// a log that cannot be truncated refuses everything after
+	writable := w.file
+
+	w.file, err = os.Open(filepath.Join(dir, walFileName))
+	if err != nil {
+		t.Fatalf("Expected to open the log read only but got %v", err)
+	}
+
+	if err = w.append(walRecord{Seq: 3, Op: walDelete, Key: "key3"}); !errors.Is(err, ErrLogFailed) {
+		t.Errorf("Expected the log to fail but got %v", err)
+	}
+
+	_ = w.file.Close()
+	w.file = writable
+
+	if err = w.append(walRecord{Seq: 4, Op: walDelete, Key: "key4"}); !errors.Is(err, ErrLogFailed) {
+		t.Errorf("Expected a failed log to refuse later records but got %v", err)
+	}
+
+	_ = w.close()
+}
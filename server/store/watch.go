@@ -0,0 +1,234 @@
+package store
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultWatchBuffer how many events a watcher may fall behind by before it
+// is dropped.
+const DefaultWatchBuffer = 256
+
+// EventType what a change did to a key.
+type EventType string
+
+const (
+	// EventPut a key was written.
+	EventPut EventType = "put"
+	// EventDelete a key was deleted.
+	EventDelete EventType = "delete"
+	// EventEvict a key was evicted to make room.
+	EventEvict EventType = "evict"
+	// EventExpire a key expired.
+	EventExpire EventType = "expire"
+)
+
+// Event a committed change to a key. Seq is the sequence number of the
+// change, Version the version of the key it wrote or removed, Owner who owns
+// that version and Timestamp when the change was committed in unix
+// nanoseconds. Only the owner and grants of the value are kept, not the
+// value itself, so events kept for the change feed or waiting for a watcher
+// hold on to no more than deciding who may see them needs.
+type Event struct {
+	Seq       uint64    `json:"seq"`
+	Type      EventType `json:"type"`
+	Key       string    `json:"key"`
+	Owner     string    `json:"owner"`
+	Version   uint64    `json:"version"`
+	Timestamp int64     `json:"timestamp"`
+	acl       ACL
+}
+
+// visible reports whether who may see the event, which they may if they could
+// read the value it wrote or removed.
+func (e Event) visible(who identity) bool {
+	return e.Owner != "" && DataValue{Owner: e.Owner, ACL: e.acl}.allows(who, rightRead)
+}
+
+// events describes the key changes among records as they are committed. The
+// value a removed key had is read from the versions index, so it must be
+// called before the records are published.
+func (s *Store) events(records []walRecord) []Event {
+	now := time.Now().UnixNano()
+
+	var events []Event
+
+	for _, record := range records {
+		event := Event{Seq: record.Seq, Key: record.Key, Timestamp: now}
+
+		var value *DataValue
+
+		switch {
+		case record.Op == walUpsert && record.Entry != nil:
+			event.Type = EventPut
+			value = record.Entry
+		case record.Op == walDelete:
+			event.Type = record.cause
+			if event.Type == "" {
+				event.Type = EventDelete
+			}
+
+			if loaded, ok := s.versions.chains.Load(record.Key); ok {
+				chain, _ := loaded.(*mvccChain)
+				if head := chain.head.Load(); head != nil {
+					value = head.value
+				}
+			}
+		default:
+			continue
+		}
+
+		if value != nil {
+			event.Owner = value.Owner
+			event.Version = value.Version
+			event.acl = value.ACL.clone()
+		}
+
+		events = append(events, event)
+	}
+
+	return events
+}
+
+// watcher a caller following changes to a key, or to every key with a
+// prefix if key is not set.
+type watcher struct {
+	key    string
+	prefix string
+	who    identity
+	events chan Event
+}
+
+// wants reports whether the watcher follows the event.
+func (w *watcher) wants(event Event) bool {
+	if w.key != "" {
+		return event.Key == w.key
+	}
+
+	return strings.HasPrefix(event.Key, w.prefix)
+}
+
+// watchers the callers following changes. Events are handed over without
+// waiting, a watcher too far behind to take one being dropped so the store
+// never waits on it.
+type watchers struct {
+	mutex sync.Mutex
+	all   map[*watcher]bool
+}
+
+func newWatchers() *watchers {
+	return &watchers{all: make(map[*watcher]bool)}
+}
+
+// notify hands events to the watchers following them. It is only called with
+// the store's commitMutex held so each watcher sees events in order.
+func (ws *watchers) notify(events []Event) {
+	if len(events) == 0 {
+		return
+	}
+
+	ws.mutex.Lock()
+	defer ws.mutex.Unlock()
+
+	for w := range ws.all {
+		for _, event := range events {
+			if !w.wants(event) || !event.visible(w.who) {
+				continue
+			}
+
+			select {
+			case w.events <- event:
+			default:
+				ws.drop(w)
+			}
+
+			if !ws.all[w] {
+				break
+			}
+		}
+	}
+}
+
+// drop stops a watcher, closing its events. The mutex must be held.
+func (ws *watchers) drop(w *watcher) {
+	if ws.all[w] {
+		delete(ws.all, w)
+		close(w.events)
+	}
+}
+
+// dropAll stops every watcher.
+func (ws *watchers) dropAll() {
+	ws.mutex.Lock()
+	defer ws.mutex.Unlock()
+
+	for w := range ws.all {
+		ws.drop(w)
+	}
+}
+
+// Watch follows the changes committed to a key.
+type Watch struct {
+	// Events receives the changes in the order they were committed. It is
+	// closed if the watch falls more than DefaultWatchBuffer events behind,
+	// when it is closed and when the store is closed.
+	Events <-chan Event
+
+	watchers *watchers
+	watcher  *watcher
+}
+
+// Close stops the watch.
+func (w *Watch) Close() {
+	w.watchers.mutex.Lock()
+	defer w.watchers.mutex.Unlock()
+
+	w.watchers.drop(w.watcher)
+}
+
+// Watch follows changes to key, or if it is not set to every key starting
+// with prefix, that owner may read. Whether owner may read a key is decided
+// by the groups they belong to when the watch starts. The watch must be
+// closed once no longer needed.
+func (s *Store) Watch(owner, key, prefix string) *Watch {
+	w := &watcher{key: key, prefix: prefix, who: s.identify(owner), events: make(chan Event, DefaultWatchBuffer)}
+
+	return s.watch(w)
+}
+
+// WatchFrom follows changes as Watch does, first replaying those committed
+// after since that are still kept for the change feed, so a caller carrying
+// on from the last change it saw misses none. The response is ErrResync if
+// changes after since are no longer kept.
+func (s *Store) WatchFrom(owner, key, prefix string, since uint64) (*Watch, error) {
+	w := &watcher{key: key, prefix: prefix, who: s.identify(owner)}
+
+	// no change is committed between the replay and the watch starting
+	s.commitMutex.Lock()
+	defer s.commitMutex.Unlock()
+
+	missed, err := s.changes.after(since, func(event Event) bool {
+		return w.wants(event) && event.visible(w.who)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	w.events = make(chan Event, len(missed)+DefaultWatchBuffer)
+
+	for _, event := range missed {
+		w.events <- event
+	}
+
+	return s.watch(w), nil
+}
+
+// watch starts w.
+func (s *Store) watch(w *watcher) *Watch {
+	s.watchers.mutex.Lock()
+	s.watchers.all[w] = true
+	s.watchers.mutex.Unlock()
+
+	return &Watch{Events: w.events, watchers: s.watchers, watcher: w}
+}
@@ -0,0 +1,141 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// nextEvent waits for the watch's next event, failing if there is none.
+func nextEvent(t *testing.T, watch *Watch) Event {
+	t.Helper()
+
+	select {
+	case event, ok := <-watch.Events:
+		if !ok {
+			t.Fatal("Expected an event but the watch was closed")
+		}
+
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("Expected an event but got none")
+	}
+
+	return Event{}
+}
+
+func TestWatch(t *testing.T) {
+	s := openTestStore(t, Options{Depth: 2, Shards: 1})
+	defer s.Close()
+
+	watch := s.Watch("user1", "", "app/")
+	defer watch.Close()
+
+	key := s.Watch("user2", "app/1", "")
+	defer key.Close()
+
+	<-s.Upsert("app/1", "user1", "value")
+	<-s.Upsert("web/1", "user1", "value")
+	<-s.Delete("app/1", "user1")
+	<-s.UpsertWith(UpsertRequest{Key: "app/2", Owner: "user1", Value: "value", TTL: 10 * time.Millisecond})
+
+	for _, expected := range []EventType{EventPut, EventDelete, EventPut, EventExpire} {
+		if event := nextEvent(t, watch); event.Type != expected || event.Owner != "user1" || event.Version == 0 {
+			t.Errorf("Expected a %s event but got %v", expected, event)
+		}
+	}
+
+	<-s.Upsert("app/3", "user1", "value")
+	<-s.Upsert("app/4", "user1", "value")
+	<-s.Upsert("app/5", "user1", "value")
+
+	var evicted bool
+
+	for i := 0; i < 4; i++ {
+		if nextEvent(t, watch).Type == EventEvict {
+			evicted = true
+		}
+	}
+
+	if !evicted {
+		t.Error("Expected an evict event")
+	}
+
+	select {
+	case event := <-key.Events:
+		t.Errorf("Expected another user not to see changes to a key they cannot read but got %v", event)
+	default:
+	}
+}
+
+func TestSlowWatcherIsDropped(t *testing.T) {
+	s := openTestStore(t, Options{Depth: 1000})
+	defer s.Close()
+
+	watch := s.Watch("user1", "", "")
+	defer watch.Close()
+
+	for i := 0; i <= DefaultWatchBuffer; i++ {
+		<-s.Upsert(fmt.Sprintf("key%d", i), "user1", "value")
+	}
+
+	received := 0
+	for range watch.Events {
+		received++
+	}
+
+	if received != DefaultWatchBuffer {
+		t.Errorf("Expected a watcher that fell behind to be closed after %d events but got %d",
+			DefaultWatchBuffer, received)
+	}
+}
+
+func TestEventKeepsGrants(t *testing.T) {
+	s := openTestStore(t, Options{Depth: DefaultDepth})
+	defer s.Close()
+
+	<-s.Upsert("key1", "user1", "value")
+	<-s.GrantAccess("key1", "user1", "user2", Grant{Read: true})
+	<-s.Delete("key1", "user1")
+
+	page, err := s.Changes("user2", 0, 0)
+	if err != nil || len(page.Changes) != 2 || page.Changes[1].Type != EventDelete {
+		t.Errorf("Expected a grantee to see the grant and the delete but got %v, %v", page, err)
+	}
+
+	if page, _ = s.Changes("user3", 0, 0); len(page.Changes) != 0 {
+		t.Errorf("Expected a user without a grant to see nothing but got %v", page)
+	}
+}
+
+func TestWatchFrom(t *testing.T) {
+	s := openTestStore(t, Options{Depth: DefaultDepth, ChangeBuffer: 4})
+	defer s.Close()
+
+	first, _ := (<-s.Upsert("app/1", "user1", "value")).(DataValue)
+	<-s.Upsert("web/1", "user1", "value")
+	<-s.Upsert("app/2", "user1", "value")
+
+	watch, err := s.WatchFrom("user1", "", "app/", first.Version)
+	if err != nil {
+		t.Fatalf("Expected to carry on from the first change but got %v", err)
+	}
+	defer watch.Close()
+
+	<-s.Upsert("app/3", "user1", "value")
+
+	// the change missed is replayed, then the watch carries on
+	for _, expected := range []string{"app/2", "app/3"} {
+		if event := nextEvent(t, watch); event.Key != expected {
+			t.Errorf("Expected a change to %s but got %v", expected, event)
+		}
+	}
+
+	for i := 0; i < 4; i++ {
+		<-s.Upsert(fmt.Sprintf("web/%d", i), "user1", "value")
+	}
+
+	if _, err := s.WatchFrom("user1", "", "app/", first.Version); err != ErrResync {
+		t.Errorf("Expected carrying on from a change no longer kept to need a resync but got %v", err)
+	}
+}